@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/accounts"
+)
+
+var accountName string
+
+func listAccounts(ctx context.Context) ([]accounts.Account, error) {
+	var accountList []accounts.Account
+	iter := cfClient.Accounts.ListAutoPaging(ctx, accounts.AccountListParams{})
+	for iter.Next() {
+		accountList = append(accountList, iter.Current())
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error listing accounts - %w", err)
+	}
+
+	return accountList, nil
+}
+
+// getAccount resolves the account to work in from --account-id, --account-name,
+// the only available account or the user's choice, and remembers it.
+func getAccount(ctx context.Context) (*accounts.Account, error) {
+	if accountID != "" {
+		account, err := cfClient.Accounts.Get(ctx, accounts.AccountGetParams{AccountID: cf.F(accountID)})
+		if err != nil {
+			return nil, fmt.Errorf("error getting account %s - %w", accountID, err)
+		}
+
+		rememberAccount(account)
+		return account, nil
+	}
+
+	accountList, err := listAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accountList) == 0 {
+		return nil, fmt.Errorf("no Cloudflare accounts are available for this login")
+	}
+
+	var account *accounts.Account
+	switch {
+	case accountName != "":
+		for i := range accountList {
+			if strings.EqualFold(accountList[i].Name, accountName) {
+				account = &accountList[i]
+				break
+			}
+		}
+
+		if account == nil {
+			return nil, fmt.Errorf("account %q not found, available accounts: %s", accountName, formatAccounts(accountList))
+		}
+	case len(accountList) == 1:
+		account = &accountList[0]
+	default:
+		account, err = selectAccount(accountList)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rememberAccount(account)
+	return account, nil
+}
+
+func selectAccount(accountList []accounts.Account) (*accounts.Account, error) {
+	defaultIndex := -1
+	if cfg, err := loadConfig(); err == nil {
+		for i, account := range accountList {
+			if account.ID == cfg.AccountID {
+				defaultIndex = i
+				break
+			}
+		}
+	}
+
+	if assumeYes {
+		if defaultIndex < 0 {
+			return nil, fmt.Errorf("multiple accounts available, please specify --account-id or --account-name: %s", formatAccounts(accountList))
+		}
+
+		return &accountList[defaultIndex], nil
+	}
+
+	successMessage(fmt.Sprintf("共找到 %d 个 Cloudflare 账号:\n", len(accountList)))
+	for i, account := range accountList {
+		marker := ""
+		if i == defaultIndex {
+			marker = fmtStr(" (上次使用)", GREEN, true)
+		}
+		fmt.Printf(" %s %s - %s%s\n", fmtStr(strconv.Itoa(i+1)+".", BLUE, true), account.Name, fmtStr(account.ID, ORANGE, false), marker)
+	}
+
+	prompt := "请选择要使用的账号编号: "
+	if defaultIndex >= 0 {
+		prompt = "请选择要使用的账号编号，或直接回车使用上次的账号: "
+	}
+
+	for {
+		fmt.Println("")
+		response := promptUser(prompt)
+		if response == "" && defaultIndex >= 0 {
+			return &accountList[defaultIndex], nil
+		}
+
+		index, err := strconv.Atoi(response)
+		if err != nil || index < 1 || index > len(accountList) {
+			failMessage("选择无效，请重试。")
+			continue
+		}
+
+		return &accountList[index-1], nil
+	}
+}
+
+func rememberAccount(account *accounts.Account) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	if cfg.AccountID == account.ID {
+		return
+	}
+
+	cfg.AccountID = account.ID
+	if err := saveConfig(cfg); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
+
+func formatAccounts(accountList []accounts.Account) string {
+	var names []string
+	for _, account := range accountList {
+		names = append(names, fmt.Sprintf("%s (%s)", account.Name, account.ID))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+func switchAccount() {
+	ctx := context.Background()
+	if cfClient == nil || cfAccount == nil {
+		if err := ensureLogin(ctx); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	accountList, err := listAccounts(ctx)
+	if err != nil {
+		failMessage("获取 Cloudflare 账号列表失败。")
+		log.Println(err)
+		return
+	}
+
+	if len(accountList) < 2 {
+		fmt.Printf("%s 当前登录只能访问一个账号: %s\n", info, fmtStr(cfAccount.Name, ORANGE, true))
+		return
+	}
+
+	account, err := selectAccount(accountList)
+	if err != nil {
+		failMessage(err.Error())
+		return
+	}
+
+	cfAccount = account
+	rememberAccount(account)
+	successMessage(fmt.Sprintf("已切换到账号 %s", fmtStr(account.Name, ORANGE, true)))
+}
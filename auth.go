@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/accounts"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/cloudflare/cloudflare-go/v4/kv"
+	"github.com/cloudflare/cloudflare-go/v4/pages"
+	"github.com/cloudflare/cloudflare-go/v4/shared"
+	"github.com/cloudflare/cloudflare-go/v4/user"
+	"github.com/cloudflare/cloudflare-go/v4/workers"
+	"golang.org/x/oauth2"
+)
+
+var (
+	apiToken  = os.Getenv("CLOUDFLARE_API_TOKEN")
+	accountID = os.Getenv("CLOUDFLARE_ACCOUNT_ID")
+)
+
+// tokenPermission is a permission the wizard needs from an API token. Groups
+// lists the API permission group names that grant it, probe is a read-only
+// request used when the token is not allowed to read its own policies.
+type tokenPermission struct {
+	Name   string
+	Groups []string
+	probe  func(ctx context.Context) error
+}
+
+var requiredPermissions = []tokenPermission{
+	{
+		Name:   "Workers Scripts: Edit",
+		Groups: []string{"Workers Scripts Write"},
+		probe: func(ctx context.Context) error {
+			_, err := cfClient.Workers.Scripts.List(ctx, workers.ScriptListParams{AccountID: cf.F(cfAccount.ID)})
+			return err
+		},
+	},
+	{
+		Name:   "Workers KV Storage: Edit",
+		Groups: []string{"Workers KV Storage Write"},
+		probe: func(ctx context.Context) error {
+			_, err := cfClient.KV.Namespaces.List(ctx, kv.NamespaceListParams{AccountID: cf.F(cfAccount.ID)})
+			return err
+		},
+	},
+	{
+		Name:   "Cloudflare Pages: Edit",
+		Groups: []string{"Pages Write"},
+		probe: func(ctx context.Context) error {
+			_, err := cfClient.Pages.Projects.List(ctx, pages.ProjectListParams{AccountID: cf.F(cfAccount.ID)})
+			return err
+		},
+	},
+	{
+		Name:   "Zone: Read",
+		Groups: []string{"Zone Read", "Zone Write"},
+		probe: func(ctx context.Context) error {
+			_, err := listZones(ctx)
+			return err
+		},
+	},
+	{
+		Name:   "DNS: Edit",
+		Groups: []string{"DNS Write"},
+		probe: func(ctx context.Context) error {
+			zoneList, err := listZones(ctx)
+			if err != nil || len(zoneList) == 0 {
+				return nil
+			}
+
+			_, err = cfClient.DNS.Records.List(ctx, dns.RecordListParams{ZoneID: cf.F(zoneList[0].ID)})
+			return err
+		},
+	},
+	{
+		Name:   "Workers Routes: Edit",
+		Groups: []string{"Workers Routes Write"},
+		probe: func(ctx context.Context) error {
+			zoneList, err := listZones(ctx)
+			if err != nil || len(zoneList) == 0 {
+				return nil
+			}
+
+			_, err = cfClient.Workers.Routes.List(ctx, workers.RouteListParams{ZoneID: cf.F(zoneList[0].ID)})
+			return err
+		},
+	},
+}
+
+// ensureLogin signs in unless a client and account are already set up. On
+// failure the partial login state is cleared so the next call starts over.
+func ensureLogin(ctx context.Context) error {
+	if cfClient != nil && cfAccount != nil {
+		return nil
+	}
+
+	emitStep("login", StatusStarted, nil)
+	var err error
+	if apiToken != "" {
+		if err = loginWithAPIToken(ctx, apiToken); err != nil {
+			failMessage("API 令牌验证失败。")
+		}
+	} else {
+		if err = loginWithOAuth(ctx); err != nil {
+			failMessage("登录 Cloudflare 失败。")
+		}
+	}
+
+	if err != nil {
+		cfClient, cfAccount = nil, nil
+		emitStepError("login", err)
+		return err
+	}
+
+	emitStep("login", StatusSucceeded, map[string]any{
+		"account_id":   cfAccount.ID,
+		"account_name": cfAccount.Name,
+	})
+	return nil
+}
+
+func loginWithAPIToken(ctx context.Context, token string) error {
+	fmt.Printf("\n%s 使用 API 令牌登录 %s...\n", title, fmtStr("Cloudflare", ORANGE, true))
+	cfClient = NewClient(&oauth2.Token{AccessToken: token})
+
+	tokenID, err := verifyAPIToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	cfAccount, err = getAccount(ctx)
+	if err != nil {
+		return err
+	}
+
+	missing := checkTokenPermissions(ctx, tokenID)
+	if len(missing) > 0 {
+		for _, name := range missing {
+			failMessage(fmt.Sprintf("API 令牌缺少权限: %s", fmtStr(name, RED, true)))
+		}
+
+		return fmt.Errorf("API token is missing permissions: %s", strings.Join(missing, ", "))
+	}
+
+	successMessage(fmt.Sprintf("API 令牌验证成功，账号: %s", fmtStr(cfAccount.Name, ORANGE, true)))
+	return nil
+}
+
+// verifyAPIToken checks that the token is active and returns its ID. User
+// tokens are verified first; account owned tokens need --account-id.
+func verifyAPIToken(ctx context.Context) (string, error) {
+	res, err := cfClient.User.Tokens.Verify(ctx)
+	if err == nil {
+		if res.Status != user.TokenVerifyResponseStatusActive {
+			return "", fmt.Errorf("API token is %s", res.Status)
+		}
+
+		return res.ID, nil
+	}
+
+	if accountID == "" {
+		return "", fmt.Errorf("error verifying API token: %w", err)
+	}
+
+	accountRes, er := cfClient.Accounts.Tokens.Verify(ctx, accounts.TokenVerifyParams{AccountID: cf.F(accountID)})
+	if er != nil {
+		return "", fmt.Errorf("error verifying API token: %w", errors.Join(err, er))
+	}
+
+	if accountRes.Status != accounts.TokenVerifyResponseStatusActive {
+		return "", fmt.Errorf("API token is %s", accountRes.Status)
+	}
+
+	return accountRes.ID, nil
+}
+
+// checkTokenPermissions returns the names of the required permissions the
+// token lacks. It reads the token policies when allowed to, and otherwise
+// falls back to probing each API with a read-only request.
+func checkTokenPermissions(ctx context.Context, tokenID string) []string {
+	var missing []string
+	token, err := getTokenDetails(ctx, tokenID)
+	if err != nil {
+		fmt.Printf("%s 无法读取令牌权限，改为逐项检测 API 访问（仅能检测读取权限）。\n", info)
+		for _, permission := range requiredPermissions {
+			if err := permission.probe(ctx); err != nil {
+				missing = append(missing, permission.Name)
+			}
+		}
+
+		return missing
+	}
+
+	granted := make(map[string]bool)
+	for _, policy := range token.Policies {
+		if policy.Effect != shared.TokenPolicyEffectAllow {
+			continue
+		}
+
+		for _, group := range policy.PermissionGroups {
+			granted[group.Name] = true
+		}
+	}
+
+	for _, permission := range requiredPermissions {
+		found := false
+		for _, group := range permission.Groups {
+			if granted[group] {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			missing = append(missing, permission.Name)
+		}
+	}
+
+	return missing
+}
+
+func getTokenDetails(ctx context.Context, tokenID string) (*shared.Token, error) {
+	token, err := cfClient.User.Tokens.Get(ctx, tokenID)
+	if err == nil {
+		return token, nil
+	}
+
+	return cfClient.Accounts.Tokens.Get(ctx, tokenID, accounts.TokenGetParams{AccountID: cf.F(cfAccount.ID)})
+}
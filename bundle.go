@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const bundledSource = "bundled"
+
+var offline bool
+
+func hasBundle() bool {
+	return len(bundledWorker) > 0
+}
+
+// bundleVersion returns the release tag of the embedded worker.js.
+func bundleVersion() string {
+	return strings.TrimSpace(bundledVersion)
+}
+
+// bundleSHA256 returns the hash recorded for the embedded worker.js.
+func bundleSHA256() string {
+	return strings.ToLower(strings.TrimSpace(bundledSHA256))
+}
+
+func bundleInfo() string {
+	if !hasBundle() {
+		return "worker.js: not bundled"
+	}
+
+	return fmt.Sprintf("worker.js: %s (sha256 %s)", bundleVersion(), bundleSHA256())
+}
+
+// bundledRelease describes the embedded worker.js.
+func bundledRelease() *Release {
+	return &Release{TagName: bundleVersion(), source: bundledSource}
+}
+
+// useBundledWorker writes the embedded worker.js to workerPath after checking
+// it against the hash recorded at build time.
+func useBundledWorker(release *Release) error {
+	hash := sha256.Sum256(bundledWorker)
+	if actual := hex.EncodeToString(hash[:]); actual != bundleSHA256() {
+		return fmt.Errorf("bundled worker.js is corrupt: expected sha256 %s, got %s", bundleSHA256(), actual)
+	}
+
+	if release.TagName != bundleVersion() && release.TagName != latestVersion {
+		fmt.Printf("%s 内置的 worker.js 版本为 %s，而不是 %s。\n", warning, fmtStr(bundleVersion(), ORANGE, true), fmtStr(release.TagName, ORANGE, true))
+		if !confirm("是否使用内置版本？(y/n): ", false) {
+			return fmt.Errorf("bundled worker.js is %s, not %s", bundleVersion(), release.TagName)
+		}
+	}
+
+	if err := os.WriteFile(workerPath, bundledWorker, 0o644); err != nil {
+		return fmt.Errorf("error writing bundled worker.js: %w", err)
+	}
+
+	release.TagName = bundleVersion()
+	release.Assets = nil
+	release.source = bundledSource
+	downloadedVersion = ""
+	successMessage(fmt.Sprintf("使用内置的 worker.js（%s）。", release.TagName))
+	emitStep("download", StatusSkipped, map[string]any{"source": release.source, "version": release.TagName})
+	return nil
+}
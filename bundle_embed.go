@@ -0,0 +1,17 @@
+//go:build bundled
+
+package main
+
+import _ "embed"
+
+// Filled by "make bundle", see the Makefile.
+var (
+	//go:embed bundle/worker.js
+	bundledWorker []byte
+
+	//go:embed bundle/version
+	bundledVersion string
+
+	//go:embed bundle/worker.js.sha256
+	bundledSHA256 string
+)
@@ -0,0 +1,10 @@
+//go:build !bundled
+
+package main
+
+// Builds without the bundled tag carry no worker.js.
+var (
+	bundledWorker  []byte
+	bundledVersion string
+	bundledSHA256  string
+)
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CachedWorker is a verified worker.js kept in the cache, stored as
+// workers/<version>/<sha256>.js under the cache directory.
+type CachedWorker struct {
+	Version  string
+	SHA256   string
+	Path     string
+	Size     int64
+	CachedAt time.Time
+}
+
+// cacheDir returns the per-user directory holding downloaded files that can
+// be recreated at any time, creating it if needed.
+func cacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating user cache directory: %w", err)
+	}
+
+	dir := filepath.Join(base, "bpb-wizard")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+func workerCacheDir() (string, error) {
+	dir, err := cacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "workers"), nil
+}
+
+// cacheKey turns a release tag into a single, safe path element.
+func cacheKey(version string) string {
+	key := strings.NewReplacer("/", "_", "\\", "_").Replace(version)
+	if key == "." || key == ".." {
+		key = "_" + key
+	}
+
+	return key
+}
+
+func listCachedWorkers() ([]CachedWorker, error) {
+	dir, err := workerCacheDir()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "*.js"))
+	if err != nil {
+		return nil, err
+	}
+
+	var workers []CachedWorker
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		workers = append(workers, CachedWorker{
+			Version:  filepath.Base(filepath.Dir(path)),
+			SHA256:   strings.TrimSuffix(filepath.Base(path), ".js"),
+			Path:     path,
+			Size:     stat.Size(),
+			CachedAt: stat.ModTime(),
+		})
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].CachedAt.After(workers[j].CachedAt)
+	})
+
+	return workers, nil
+}
+
+// findCachedWorker returns the newest cached worker.js matching version and,
+// when given, sha256. The "latest" version matches any cached release.
+func findCachedWorker(version, sha256 string) *CachedWorker {
+	workers, err := listCachedWorkers()
+	if err != nil {
+		return nil
+	}
+
+	for _, worker := range workers {
+		if version != latestVersion && worker.Version != cacheKey(version) {
+			continue
+		}
+
+		if sha256 != "" && worker.SHA256 != sha256 {
+			continue
+		}
+
+		return &worker
+	}
+
+	return nil
+}
+
+// storeWorker copies the verified worker.js at workerPath into the cache.
+// Builds deployed without verification are never stored.
+func storeWorker(version, sha256 string) error {
+	dir, err := workerCacheDir()
+	if err != nil {
+		return err
+	}
+
+	dest := filepath.Join(dir, cacheKey(version), sha256+".js")
+	if _, err := os.Stat(dest); err == nil {
+		now := time.Now()
+		return os.Chtimes(dest, now, now)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	if err := copyFile(workerPath, dest); err != nil {
+		return fmt.Errorf("error caching worker.js: %w", err)
+	}
+
+	return nil
+}
+
+// copyFile copies src to dest through a temporary file, so dest is never
+// left half written.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), dest)
+}
+
+// cleanCache removes the cached builds of version, or the whole cache when
+// version is empty, and returns the number of builds removed.
+func cleanCache(version string) (int, error) {
+	workers, err := listCachedWorkers()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, worker := range workers {
+		if version != "" && worker.Version != cacheKey(version) {
+			continue
+		}
+
+		if err := os.Remove(worker.Path); err != nil {
+			return removed, fmt.Errorf("error removing %s: %w", worker.Path, err)
+		}
+
+		os.Remove(filepath.Dir(worker.Path))
+		removed++
+	}
+
+	if version == "" {
+		dir, err := cacheDir()
+		if err != nil {
+			return removed, err
+		}
+
+		if err := os.RemoveAll(filepath.Join(dir, "downloads")); err != nil {
+			return removed, err
+		}
+
+		// Public suffix list cached by earlier versions.
+		if err := os.RemoveAll(filepath.Join(dir, "tld.cache")); err != nil {
+			return removed, err
+		}
+	}
+
+	return removed, nil
+}
+
+func printCachedWorkers(workers []CachedWorker) {
+	for i, worker := range workers {
+		fmt.Printf(" %s %s  %s  %.1f KB  %s\n",
+			fmtStr(fmt.Sprintf("%d.", i+1), BLUE, true),
+			fmtStr(worker.Version, ORANGE, true),
+			worker.SHA256[:min(12, len(worker.SHA256))],
+			float64(worker.Size)/1024,
+			worker.CachedAt.Format("2006-01-02 15:04"),
+		)
+	}
+}
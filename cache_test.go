@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useTempCache points the user cache directory at a fresh temp dir.
+func useTempCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LocalAppData", dir)
+}
+
+func TestFindCachedWorker(t *testing.T) {
+	useTempCache(t)
+	workerPath = filepath.Join(t.TempDir(), "worker.js")
+	if err := os.WriteFile(workerPath, []byte("export default {};"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := []struct {
+		version, sha256 string
+		age             time.Duration
+	}{
+		{"v3.0.0", "aaaa", 3 * time.Hour},
+		{"v3.0.0", "bbbb", 2 * time.Hour},
+		{"v3.1.0", "cccc", time.Hour},
+		{"feature/x", "dddd", 4 * time.Hour},
+	}
+
+	dir, err := workerCacheDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range stored {
+		if err := storeWorker(s.version, s.sha256); err != nil {
+			t.Fatal(err)
+		}
+
+		modTime := time.Now().Add(-s.age)
+		path := filepath.Join(dir, cacheKey(s.version), s.sha256+".js")
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		version, sha256 string
+		want            string
+	}{
+		{"v3.0.0", "", "bbbb"},
+		{"v3.0.0", "aaaa", "aaaa"},
+		{"v3.0.0", "cccc", ""},
+		{latestVersion, "", "cccc"},
+		{"feature/x", "", "dddd"},
+		{"v2.9.1", "", ""},
+	}
+
+	for _, tt := range tests {
+		var got string
+		if worker := findCachedWorker(tt.version, tt.sha256); worker != nil {
+			got = worker.SHA256
+		}
+
+		if got != tt.want {
+			t.Errorf("findCachedWorker(%q, %q) = %q, want %q", tt.version, tt.sha256, got, tt.want)
+		}
+	}
+}
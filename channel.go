@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+const (
+	ChannelStable     = "stable"
+	ChannelPrerelease = "prerelease"
+)
+
+// releaseChannel is the --channel of this run, empty when not given.
+var releaseChannel string
+
+// PanelConfig is what config.json remembers about one panel.
+type PanelConfig struct {
+	Channel string `json:"channel,omitempty"`
+}
+
+func parseChannel(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "stable", "":
+		return ChannelStable, nil
+	case "prerelease", "pre-release", "beta":
+		return ChannelPrerelease, nil
+	default:
+		return "", fmt.Errorf("invalid channel %q, expected stable or prerelease", value)
+	}
+}
+
+func channelName(channel string) string {
+	if channel == ChannelPrerelease {
+		return "预发布"
+	}
+
+	return "稳定版"
+}
+
+// panelKey identifies a panel in config.json. Panel names are only unique
+// within an account.
+func panelKey(panel Panel) string {
+	return cfAccount.ID + "/" + panel.Type + "/" + panel.Name
+}
+
+// panelChannel returns the release channel for panel: --channel, the channel
+// saved for the panel, the default "channel" in config.json, then stable. A
+// nil panel (one being created) skips the per panel setting.
+func panelChannel(panel *Panel) string {
+	if releaseChannel != "" {
+		return releaseChannel
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("%v\n", err)
+		return ChannelStable
+	}
+
+	if panel != nil {
+		if channel := cfg.Panels[panelKey(*panel)].Channel; channel != "" {
+			return channel
+		}
+	}
+
+	if channel, err := parseChannel(cfg.Channel); err == nil {
+		return channel
+	}
+
+	return ChannelStable
+}
+
+// rememberPanelChannel saves the --channel given for panel, so later updates
+// of the panel follow the same channel.
+func rememberPanelChannel(panel Panel) {
+	if releaseChannel == "" {
+		return
+	}
+
+	updatePanelConfig(panel, func(cfg *WizardConfig, key string) bool {
+		if cfg.Panels[key].Channel == releaseChannel {
+			return false
+		}
+
+		if cfg.Panels == nil {
+			cfg.Panels = make(map[string]PanelConfig)
+		}
+
+		cfg.Panels[key] = PanelConfig{Channel: releaseChannel}
+		return true
+	})
+}
+
+func forgetPanel(panel Panel) {
+	updatePanelConfig(panel, func(cfg *WizardConfig, key string) bool {
+		if _, ok := cfg.Panels[key]; !ok {
+			return false
+		}
+
+		delete(cfg.Panels, key)
+		return true
+	})
+}
+
+// updatePanelConfig applies update to the saved config and saves it when
+// update reports a change.
+func updatePanelConfig(panel Panel, update func(cfg *WizardConfig, key string) bool) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("%v\n", err)
+		return
+	}
+
+	if !update(cfg, panelKey(panel)) {
+		return
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		log.Printf("%v\n", err)
+	}
+}
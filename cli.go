@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+)
+
+type CreateOptions struct {
+	Type          string
+	Name          string
+	UUID          string
+	TrojanPass    string
+	ProxyIP       string
+	Fallback      string
+	SubPath       string
+	CustomDomains []string
+	KVName        string
+}
+
+var (
+	createOpts CreateOptions
+	assumeYes  bool
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `用法:
+  BPB-Wizard [-version] [登录参数] [命令] [参数]
+
+命令:
+  create           创建新面板
+  list             列出账号下的所有面板
+  update <名称>    更新面板的 worker.js（默认最新版本）
+  delete <名称>    删除面板
+  show <名称>      显示面板详情
+  login            通过浏览器登录 Cloudflare 并保存会话
+  logout           吊销并删除保存的会话
+  whoami           显示当前登录的用户和账号
+  cache list       列出缓存的 worker.js 版本
+  cache clean      清除缓存（--version 只清除指定版本）
+
+不带命令运行时将启动交互式向导。使用 "BPB-Wizard <命令> -h" 查看命令参数。
+
+参数:
+`)
+	flag.PrintDefaults()
+}
+
+func runCommand(args []string) {
+	if len(args) == 0 {
+		runWizard()
+		return
+	}
+
+	var err error
+	switch args[0] {
+	case "create":
+		err = runCreate(args[1:])
+	case "list":
+		err = runList(args[1:])
+	case "update":
+		err = runUpdate(args[1:])
+	case "delete":
+		err = runDelete(args[1:])
+	case "show":
+		err = runShow(args[1:])
+	case "login":
+		err = runLogin(args[1:])
+	case "logout":
+		err = runLogout(args[1:])
+	case "whoami":
+		err = runWhoami(args[1:])
+	case "cache":
+		err = runCache(args[1:])
+	case "help":
+		usage()
+	default:
+		failMessage(fmt.Sprintf("未知命令: %s", args[0]))
+		usage()
+		exit(2)
+	}
+
+	if err != nil {
+		failMessage(err.Error())
+		emitError(err)
+		exit(1)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.BoolVar(&assumeYes, "yes", false, "Answer all prompts with their default value")
+	fs.Func("output", "Output format: text or json", setOutputMode)
+	addLoginFlags(fs)
+	return fs
+}
+
+// addLoginFlags registers the flags controlling how the wizard signs in. They
+// are accepted both before and after the subcommand.
+func addLoginFlags(fs *flag.FlagSet) {
+	fs.Func("api-token", "Cloudflare API token used instead of the browser login (env CLOUDFLARE_API_TOKEN)", func(value string) error {
+		apiToken = value
+		return nil
+	})
+	fs.StringVar(&accountID, "account-id", accountID, "Cloudflare account ID (env CLOUDFLARE_ACCOUNT_ID)")
+	fs.StringVar(&accountName, "account-name", accountName, "Cloudflare account name")
+	fs.IntVar(&callbackPort, "callback-port", callbackPort, "Local port for the OAuth callback, 0 picks a free port")
+	fs.DurationVar(&loginTimeout, "login-timeout", loginTimeout, "How long to wait for the browser login, also how long a login URL stays valid")
+	fs.BoolVar(&noBrowser, "no-browser", noBrowser, "Print the login URL and paste the redirect URL back instead of opening a browser")
+	fs.StringVar(&config.ClientID, "oauth-client-id", config.ClientID, "OAuth client ID (env BPB_OAUTH_CLIENT_ID)")
+	fs.StringVar(&config.Endpoint.AuthURL, "oauth-auth-url", config.Endpoint.AuthURL, "OAuth authorization URL (env BPB_OAUTH_AUTH_URL)")
+	fs.StringVar(&config.Endpoint.TokenURL, "oauth-token-url", config.Endpoint.TokenURL, "OAuth token URL (env BPB_OAUTH_TOKEN_URL)")
+	fs.StringVar(&revokeURL, "oauth-revoke-url", revokeURL, "OAuth token revocation URL (env BPB_OAUTH_REVOKE_URL)")
+	fs.Func("oauth-scopes", "Comma or space separated OAuth scopes (env BPB_OAUTH_SCOPES)", func(value string) error {
+		scopes := splitScopes(value)
+		if len(scopes) == 0 {
+			return fmt.Errorf("no oauth scopes given")
+		}
+
+		config.Scopes = scopes
+		return nil
+	})
+}
+
+// addWorkerFlags registers the flags choosing and verifying the worker.js to
+// deploy.
+func addWorkerFlags(fs *flag.FlagSet) {
+	addReleaseFlags(fs)
+	addSourceFlags(fs)
+	addVerifyFlags(fs)
+}
+
+// parseFlags parses args with fs and returns the positional arguments. Unlike
+// fs.Parse it also accepts flags after positional ones, e.g. "update name --yes".
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func runCreate(args []string) error {
+	var flagOpts CreateOptions
+	var customDomains, specPath string
+	fs := newFlagSet("create")
+	fs.StringVar(&specPath, "spec", "", "Panel spec file (YAML or JSON)")
+	fs.StringVar(&flagOpts.Type, "type", "", "Deploy type: worker or pages")
+	fs.StringVar(&flagOpts.Name, "name", "", "Worker or Pages project name")
+	fs.StringVar(&flagOpts.UUID, "uuid", "", "VLESS UUID")
+	fs.StringVar(&flagOpts.TrojanPass, "trojan-pass", "", "Trojan password")
+	fs.StringVar(&flagOpts.ProxyIP, "proxy-ip", "", "Comma separated proxy IPs or domains")
+	fs.StringVar(&flagOpts.Fallback, "fallback", "", "Fallback domain")
+	fs.StringVar(&flagOpts.SubPath, "sub-path", "", "Subscription URI path")
+	fs.StringVar(&customDomains, "custom-domain", "", "Comma separated custom domains registered on this account")
+	fs.StringVar(&flagOpts.KVName, "kv-name", "", "KV namespace name")
+	addWorkerFlags(fs)
+	addSecretFlags(fs)
+	addDomainFlags(fs)
+	if positional := parseFlags(fs, args); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	flagOpts.CustomDomains = splitList(customDomains)
+	createOpts = flagOpts
+	if specPath != "" {
+		spec, err := loadPanelSpec(specPath)
+		if err != nil {
+			return err
+		}
+
+		createOpts = mergeOptions(spec.options(), flagOpts)
+	}
+
+	if errs := validateCreateOptions(createOpts); len(errs) > 0 {
+		for _, err := range errs {
+			failMessage(err.Error())
+			emitFieldError(err)
+		}
+
+		return fmt.Errorf("invalid panel settings: %d field(s) failed validation", len(errs))
+	}
+
+	if _, err := loadCredentialPolicy(); err != nil {
+		return err
+	}
+
+	if err := ensureLogin(context.Background()); err != nil {
+		return err
+	}
+
+	createPanel()
+	return nil
+}
+
+func runList(args []string) error {
+	fs := newFlagSet("list")
+	if positional := parseFlags(fs, args); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	ctx := context.Background()
+	if err := ensureLogin(ctx); err != nil {
+		return err
+	}
+
+	panels := getPanels(ctx)
+	if len(panels) == 0 {
+		failMessage("未找到 Workers 或 Pages。")
+		return nil
+	}
+
+	printPanels(panels)
+
+	var result []map[string]any
+	for _, panel := range panels {
+		result = append(result, map[string]any{"name": panel.Name, "type": panel.Type})
+	}
+
+	emitResult(map[string]any{"panels": result})
+	return nil
+}
+
+// panelCommand parses the arguments of a command acting on one panel and
+// looks the panel up. extraFlags, if not nil, registers command specific flags.
+func panelCommand(name string, args []string, extraFlags func(*flag.FlagSet)) (context.Context, Panel, error) {
+	var panelType string
+	fs := newFlagSet(name)
+	fs.StringVar(&panelType, "type", "", "Panel type when the name is ambiguous: worker or pages")
+	if extraFlags != nil {
+		extraFlags(fs)
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		return nil, Panel{}, fmt.Errorf("usage: %s <name> [--type worker|pages] [--yes]", name)
+	}
+
+	if panelType != "" {
+		deployType, err := parseDeployType(panelType)
+		if err != nil {
+			return nil, Panel{}, err
+		}
+
+		panelType = "workers"
+		if deployType == DTPage {
+			panelType = "pages"
+		}
+	}
+
+	ctx := context.Background()
+	if err := ensureLogin(ctx); err != nil {
+		return nil, Panel{}, err
+	}
+
+	panel, err := findPanel(ctx, positional[0], panelType)
+	if err != nil {
+		return nil, Panel{}, err
+	}
+
+	return ctx, panel, nil
+}
+
+func runUpdate(args []string) error {
+	ctx, panel, err := panelCommand("update", args, func(fs *flag.FlagSet) {
+		addWorkerFlags(fs)
+		addUpdateFlags(fs)
+		addSecretFlags(fs)
+	})
+	if err != nil {
+		return err
+	}
+
+	updatePanel(ctx, panel)
+	return nil
+}
+
+func runDelete(args []string) error {
+	ctx, panel, err := panelCommand("delete", args, nil)
+	if err != nil {
+		return err
+	}
+
+	prompt := fmt.Sprintf("确定要%s %s 吗？(y/n): ", fmtStr("删除", RED, true), fmtStr(panel.Name, ORANGE, true))
+	if !confirmStrict(prompt, true) {
+		return nil
+	}
+
+	deletePanel(ctx, panel)
+	return nil
+}
+
+func runShow(args []string) error {
+	ctx, panel, err := panelCommand("show", args, nil)
+	if err != nil {
+		return err
+	}
+
+	showPanel(ctx, panel)
+	return nil
+}
+
+func runLogin(args []string) error {
+	fs := newFlagSet("login")
+	if positional := parseFlags(fs, args); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	ctx := context.Background()
+	emitStep("login", StatusStarted, nil)
+	if err := browserLogin(ctx); err != nil {
+		emitStepError("login", err)
+		return err
+	}
+
+	emitStep("login", StatusSucceeded, map[string]any{
+		"account_id":   cfAccount.ID,
+		"account_name": cfAccount.Name,
+	})
+	successMessage(fmt.Sprintf("已登录账号 %s，会话已保存。", fmtStr(cfAccount.Name, ORANGE, true)))
+	return nil
+}
+
+func runLogout(args []string) error {
+	fs := newFlagSet("logout")
+	if positional := parseFlags(fs, args); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	return logout(context.Background())
+}
+
+func runWhoami(args []string) error {
+	fs := newFlagSet("whoami")
+	if positional := parseFlags(fs, args); len(positional) > 0 {
+		return fmt.Errorf("unexpected argument %q", positional[0])
+	}
+
+	return whoami(context.Background())
+}
+
+func runCache(args []string) error {
+	var version string
+	fs := newFlagSet("cache")
+	fs.StringVar(&version, "version", "", "Only clean the cached builds of this release")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: cache list|clean [--version vX.Y.Z]")
+	}
+
+	switch positional[0] {
+	case "list":
+		workers, err := listCachedWorkers()
+		if err != nil {
+			return err
+		}
+
+		if len(workers) == 0 {
+			fmt.Printf("%s 缓存为空。\n", info)
+		} else {
+			printCachedWorkers(workers)
+		}
+
+		var result []map[string]any
+		for _, worker := range workers {
+			result = append(result, map[string]any{
+				"version":   worker.Version,
+				"sha256":    worker.SHA256,
+				"size":      worker.Size,
+				"cached_at": worker.CachedAt,
+				"path":      worker.Path,
+			})
+		}
+
+		emitResult(map[string]any{"workers": result})
+		return nil
+	case "clean":
+		prompt := "确定要清除所有缓存吗？(y/n): "
+		if version != "" {
+			prompt = fmt.Sprintf("确定要清除 %s 的缓存吗？(y/n): ", fmtStr(version, ORANGE, true))
+		}
+
+		if !confirmStrict(prompt, true) {
+			return nil
+		}
+
+		removed, err := cleanCache(version)
+		if err != nil {
+			return err
+		}
+
+		successMessage(fmt.Sprintf("已清除 %d 个缓存的 worker.js。", removed))
+		emitResult(map[string]any{"removed": removed})
+		return nil
+	default:
+		return fmt.Errorf("unknown cache command %q, expected list or clean", positional[0])
+	}
+}
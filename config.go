@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WizardConfig is the state remembered between runs in config.json.
+type WizardConfig struct {
+	AccountID       string                 `json:"account_id,omitempty"`
+	Credentials     *CredentialPolicy      `json:"credentials,omitempty"`
+	WorkerHashes    map[string]string      `json:"worker_hashes,omitempty"`
+	WorkerPublicKey string                 `json:"worker_public_key,omitempty"`
+	WorkerMirrors   []string               `json:"worker_mirrors,omitempty"`
+	Channel         string                 `json:"channel,omitempty"`
+	SecretVars      []string               `json:"secret_vars,omitempty"`
+	Panels          map[string]PanelConfig `json:"panels,omitempty"`
+}
+
+// configDir returns the per-user directory holding the wizard's saved state,
+// creating it with owner-only permissions if needed.
+func configDir() (string, error) {
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("error locating user config directory: %w", err)
+	}
+
+	dir := filepath.Join(base, "bpb-wizard")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("error creating config directory: %w", err)
+	}
+
+	return dir, nil
+}
+
+// writePrivateFile atomically replaces path with data readable only by the
+// current user.
+func writePrivateFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.json"), nil
+}
+
+func loadConfig() (*WizardConfig, error) {
+	cfg := &WizardConfig{}
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, fmt.Errorf("error reading config: %w", err)
+	}
+
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return cfg, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+func saveConfig(cfg *WizardConfig) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling config: %w", err)
+	}
+
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+
+	return nil
+}
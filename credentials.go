@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// unsafeSecretChars are removed from generated values unless the policy says
+// otherwise. Unencoded in a trojan://pass@host:port?query#name URI they end
+// the password or start an escape (@ : / ? # [ ] % , ;), and in a shell they
+// quote, expand or redirect (' " ` $ ! & | ( ) < > * ^ { } \ ~).
+const unsafeSecretChars = "!\"#$%&'()*,/:;<>?@[\\]^`{|}~"
+
+// SecretPolicy controls how one kind of generated credential looks. Unset
+// fields fall back to the built-in defaults. Exclude is a pointer so that an
+// explicit "" keeps every character of the charset.
+type SecretPolicy struct {
+	Length     int     `json:"length,omitempty"`
+	Charset    string  `json:"charset,omitempty"`
+	Exclude    *string `json:"exclude,omitempty"`
+	MinEntropy float64 `json:"min_entropy,omitempty"`
+}
+
+// CredentialPolicy is the "credentials" section of config.json.
+type CredentialPolicy struct {
+	ProjectName SecretPolicy `json:"project_name"`
+	TrojanPass  SecretPolicy `json:"trojan_pass"`
+	SubPath     SecretPolicy `json:"sub_path"`
+}
+
+var defaultExclude = unsafeSecretChars
+
+var defaultCredentialPolicy = CredentialPolicy{
+	ProjectName: SecretPolicy{Length: 32, Charset: CharsetSubDomain, Exclude: &defaultExclude, MinEntropy: 64},
+	TrojanPass:  SecretPolicy{Length: 12, Charset: CharsetTrojanPassword, Exclude: &defaultExclude, MinEntropy: 64},
+	SubPath:     SecretPolicy{Length: 16, Charset: CharsetURIPath, Exclude: &defaultExclude, MinEntropy: 64},
+}
+
+// credentialPolicy is the policy used by the generators, see loadCredentialPolicy.
+var credentialPolicy = defaultCredentialPolicy
+
+func (p SecretPolicy) withDefaults(def SecretPolicy) SecretPolicy {
+	if p.Length == 0 {
+		p.Length = def.Length
+	}
+	if p.Charset == "" {
+		p.Charset = def.Charset
+	}
+	if p.Exclude == nil {
+		p.Exclude = def.Exclude
+	}
+	if p.MinEntropy == 0 {
+		p.MinEntropy = def.MinEntropy
+	}
+
+	return p
+}
+
+// alphabet returns the distinct characters of the charset minus the excluded ones.
+func (p SecretPolicy) alphabet() string {
+	var exclude string
+	if p.Exclude != nil {
+		exclude = *p.Exclude
+	}
+
+	var b strings.Builder
+	for _, c := range p.Charset {
+		if strings.ContainsRune(exclude, c) || strings.ContainsRune(b.String(), c) {
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+// entropy estimates the bits of entropy of a value generated with the policy.
+func (p SecretPolicy) entropy() float64 {
+	size := len(p.alphabet())
+	if size < 2 {
+		return 0
+	}
+
+	return float64(p.Length) * math.Log2(float64(size))
+}
+
+// check makes sure values generated with the policy pass validation: every
+// character must be in allowed and the length at most maxLength.
+func (p SecretPolicy) check(allowed string, maxLength int) error {
+	if p.Length < 1 || p.Length > maxLength {
+		return fmt.Errorf("length must be between 1 and %d", maxLength)
+	}
+
+	alphabet := p.alphabet()
+	for _, c := range alphabet {
+		if !strings.ContainsRune(allowed, c) {
+			return fmt.Errorf("charset contains %q which is not allowed", c)
+		}
+	}
+
+	if len(alphabet) < 2 {
+		return fmt.Errorf("charset needs at least 2 usable characters")
+	}
+
+	if bits := p.entropy(); bits < p.MinEntropy {
+		return fmt.Errorf("estimated entropy %.1f bits is below the minimum of %.1f bits", bits, p.MinEntropy)
+	}
+
+	return nil
+}
+
+// loadCredentialPolicy reads the credentials section of config.json on top of
+// the defaults and rejects policies that would produce weak or invalid values.
+func loadCredentialPolicy() (CredentialPolicy, error) {
+	policy := defaultCredentialPolicy
+	cfg, err := loadConfig()
+	if err != nil {
+		return policy, err
+	}
+
+	if cfg.Credentials == nil {
+		return policy, nil
+	}
+
+	policy = CredentialPolicy{
+		ProjectName: cfg.Credentials.ProjectName.withDefaults(defaultCredentialPolicy.ProjectName),
+		TrojanPass:  cfg.Credentials.TrojanPass.withDefaults(defaultCredentialPolicy.TrojanPass),
+		SubPath:     cfg.Credentials.SubPath.withDefaults(defaultCredentialPolicy.SubPath),
+	}
+
+	if err := policy.ProjectName.check(CharsetSubDomain, 63); err != nil {
+		return policy, fmt.Errorf("credentials.project_name: %w", err)
+	}
+
+	if err := policy.TrojanPass.check(CharsetTrojanPassword, 128); err != nil {
+		return policy, fmt.Errorf("credentials.trojan_pass: %w", err)
+	}
+
+	if err := policy.SubPath.check(CharsetURIPath, 128); err != nil {
+		return policy, fmt.Errorf("credentials.sub_path: %w", err)
+	}
+
+	return policy, nil
+}
+
+func formatEntropy(bits float64) string {
+	return fmtStr(fmt.Sprintf("(约 %.0f 位熵)", bits), BLUE, false)
+}
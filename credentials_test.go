@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultPolicyAlphabets(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  SecretPolicy
+		allowed string
+		want    string
+	}{
+		{"project_name", defaultCredentialPolicy.ProjectName, CharsetSubDomain, CharsetSubDomain},
+		{"trojan_pass", defaultCredentialPolicy.TrojanPass, CharsetTrojanPassword, CharsetAlphaNumeric + "_+."},
+		{"sub_path", defaultCredentialPolicy.SubPath, CharsetURIPath, CharsetAlphaNumeric + "_-+."},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.alphabet(); got != tt.want {
+			t.Errorf("%s: alphabet() = %q, want %q", tt.name, got, tt.want)
+		}
+
+		if strings.ContainsAny(tt.policy.alphabet(), unsafeSecretChars) {
+			t.Errorf("%s: alphabet() contains unsafe characters", tt.name)
+		}
+
+		if err := tt.policy.check(tt.allowed, 128); err != nil {
+			t.Errorf("%s: check() = %v", tt.name, err)
+		}
+	}
+}
+
+func TestSecretPolicyWithDefaults(t *testing.T) {
+	def := defaultCredentialPolicy.TrojanPass
+	empty := ""
+	custom := "0O1l"
+
+	tests := []struct {
+		name   string
+		policy SecretPolicy
+		want   string
+	}{
+		{"unset exclude uses the default", SecretPolicy{}, unsafeSecretChars},
+		{"explicit empty exclude is kept", SecretPolicy{Exclude: &empty}, ""},
+		{"custom exclude is kept", SecretPolicy{Exclude: &custom}, custom},
+	}
+
+	for _, tt := range tests {
+		got := tt.policy.withDefaults(def)
+		if got.Exclude == nil || *got.Exclude != tt.want {
+			t.Errorf("%s: Exclude = %v, want %q", tt.name, got.Exclude, tt.want)
+		}
+
+		if got.Length != def.Length || got.Charset != def.Charset || got.MinEntropy != def.MinEntropy {
+			t.Errorf("%s: withDefaults() = %+v, want the default length, charset and entropy", tt.name, got)
+		}
+	}
+
+	withEmpty := SecretPolicy{Exclude: &empty}.withDefaults(def)
+	if got := withEmpty.alphabet(); got != CharsetTrojanPassword {
+		t.Errorf("alphabet() with an empty exclude = %q, want the whole charset %q", got, CharsetTrojanPassword)
+	}
+}
+
+func TestSecretPolicyCheck(t *testing.T) {
+	empty, equals, ab := "", "=", "ab"
+	tests := []struct {
+		name    string
+		policy  SecretPolicy
+		wantErr string
+	}{
+		{"valid", SecretPolicy{Length: 16, Charset: CharsetAlphaNumeric, Exclude: &empty, MinEntropy: 64}, ""},
+		{"zero length", SecretPolicy{Length: 0, Charset: CharsetAlphaNumeric, Exclude: &empty}, "length"},
+		{"too long", SecretPolicy{Length: 129, Charset: CharsetAlphaNumeric, Exclude: &empty}, "length"},
+		{"disallowed character", SecretPolicy{Length: 16, Charset: "abc=", Exclude: &empty}, "not allowed"},
+		{"excluded disallowed character", SecretPolicy{Length: 64, Charset: "abc=", Exclude: &equals, MinEntropy: 64}, ""},
+		{"one usable character", SecretPolicy{Length: 16, Charset: "aaa", Exclude: &empty}, "at least 2"},
+		{"everything excluded", SecretPolicy{Length: 16, Charset: "ab", Exclude: &ab}, "at least 2"},
+		{"low entropy", SecretPolicy{Length: 8, Charset: "0123456789", Exclude: &empty, MinEntropy: 64}, "entropy"},
+	}
+
+	for _, tt := range tests {
+		err := tt.policy.check(CharsetAlphaNumeric, 128)
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s: check() = %v, want nil", tt.name, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s: check() = %v, want an error about %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
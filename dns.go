@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/dns"
+	"github.com/cloudflare/cloudflare-go/v4/zones"
+)
+
+var (
+	errZoneNotFound = errors.New("zone not found in this account")
+	errRecordsKept  = errors.New("conflicting DNS records were kept")
+)
+
+// listZones returns all zones of the account.
+func listZones(ctx context.Context) ([]zones.Zone, error) {
+	var result []zones.Zone
+	iter := cfClient.Zones.ListAutoPaging(ctx, zones.ZoneListParams{
+		Account: cf.F(zones.ZoneListParamsAccount{
+			ID: cf.F(cfAccount.ID),
+		}),
+		PerPage: cf.F(50.0),
+	})
+	for iter.Next() {
+		result = append(result, iter.Current())
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("error listing zones: %w", err)
+	}
+
+	return result, nil
+}
+
+// matchZone returns the zone hostname belongs to: the one whose name is the
+// longest suffix of hostname on a label boundary. That picks a subdomain
+// zone like sub.example.com over example.com, never matches example.com for
+// myexample.com, and needs no public suffix list for TLDs like co.uk.
+func matchZone(accountZones []zones.Zone, hostname string) *zones.Zone {
+	hostname = strings.ToLower(strings.TrimSuffix(hostname, "."))
+	var best *zones.Zone
+	for i, zone := range accountZones {
+		name := strings.ToLower(zone.Name)
+		if hostname != name && !strings.HasSuffix(hostname, "."+name) {
+			continue
+		}
+
+		if best == nil || len(name) > len(best.Name) {
+			best = &accountZones[i]
+		}
+	}
+
+	return best
+}
+
+// findZone returns the zone of the account that hostname belongs to.
+func findZone(ctx context.Context, hostname string) (*zones.Zone, error) {
+	accountZones, err := listZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if zone := matchZone(accountZones, hostname); zone != nil {
+		return zone, nil
+	}
+
+	if len(accountZones) == 0 {
+		return nil, fmt.Errorf("%w: %s, the account has no zones", errZoneNotFound, hostname)
+	}
+
+	names := make([]string, len(accountZones))
+	for i, zone := range accountZones {
+		names[i] = zone.Name
+	}
+
+	return nil, fmt.Errorf("%w: %s, available zones: %s", errZoneNotFound, hostname, strings.Join(names, ", "))
+}
+
+// conflictingRecords returns the records of name that cannot coexist with a
+// CNAME for it.
+func conflictingRecords(ctx context.Context, zoneID, name string) ([]dns.RecordResponse, error) {
+	res, err := cfClient.DNS.Records.List(ctx, dns.RecordListParams{
+		ZoneID: cf.F(zoneID),
+		Name:   cf.F(dns.RecordListParamsName{Exact: cf.F(name)}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing DNS records: %w", err)
+	}
+
+	var records []dns.RecordResponse
+	for _, record := range res.Result {
+		switch record.Type {
+		case dns.RecordResponseTypeA, dns.RecordResponseTypeAAAA, dns.RecordResponseTypeCNAME:
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// ensureCNAME points hostname at target with a proxied CNAME in zone,
+// creating or updating the record. Other A, AAAA or CNAME records of
+// hostname are only replaced after the user agrees, otherwise errRecordsKept
+// is returned.
+func ensureCNAME(ctx context.Context, zone *zones.Zone, hostname, target string) error {
+	records, err := conflictingRecords(ctx, zone.ID, hostname)
+	if err != nil {
+		return err
+	}
+
+	var existing *dns.RecordResponse
+	var conflicts []dns.RecordResponse
+	for i, record := range records {
+		if record.Type == dns.RecordResponseTypeCNAME && strings.EqualFold(record.Content, target) {
+			existing = &records[i]
+			continue
+		}
+
+		conflicts = append(conflicts, record)
+	}
+
+	if existing != nil && existing.Proxied && len(conflicts) == 0 {
+		successMessage(fmt.Sprintf("%s 的 CNAME 记录已存在。", hostname))
+		return nil
+	}
+
+	if len(conflicts) > 0 {
+		fmt.Printf("%s %s 已有以下 DNS 记录，需要替换为指向 %s 的 CNAME 记录:\n", warning, fmtStr(hostname, GREEN, true), fmtStr(target, GREEN, true))
+		for _, record := range conflicts {
+			fmt.Printf(" - %s %s（代理: %t）\n", record.Type, record.Content, record.Proxied)
+		}
+
+		if !confirmStrict("是否替换这些记录？(y/n): ", false) {
+			return fmt.Errorf("%w: %s", errRecordsKept, hostname)
+		}
+
+		for _, record := range conflicts {
+			if _, err := cfClient.DNS.Records.Delete(ctx, record.ID, dns.RecordDeleteParams{ZoneID: cf.F(zone.ID)}); err != nil {
+				return fmt.Errorf("error deleting DNS record: %w", err)
+			}
+
+			resources.addDeleted("dns_record", "DNS 记录", fmt.Sprintf("%s %s %s", record.Name, record.Type, record.Content), func(ctx context.Context) error {
+				_, err := cfClient.DNS.Records.New(ctx, dns.RecordNewParams{ZoneID: cf.F(zone.ID), Record: recordParam(record)})
+				return err
+			})
+		}
+	}
+
+	cname := dns.CNAMERecordParam{
+		Name:    cf.F(hostname),
+		Content: cf.F(target),
+		Proxied: cf.F(true),
+		TTL:     cf.F(dns.TTL1),
+		Type:    cf.F(dns.CNAMERecordTypeCNAME),
+	}
+
+	if existing != nil {
+		if _, err := cfClient.DNS.Records.Update(ctx, existing.ID, dns.RecordUpdateParams{ZoneID: cf.F(zone.ID), Record: cname}); err != nil {
+			return fmt.Errorf("error updating DNS record: %w", err)
+		}
+
+		successMessage(fmt.Sprintf("已为 %s 开启 CNAME 记录代理。", hostname))
+		return nil
+	}
+
+	record, err := cfClient.DNS.Records.New(ctx, dns.RecordNewParams{ZoneID: cf.F(zone.ID), Record: cname})
+	if err != nil {
+		return fmt.Errorf("error creating DNS record: %w", err)
+	}
+
+	resources.add("dns_record", "DNS 记录", hostname, func(ctx context.Context) error {
+		_, err := cfClient.DNS.Records.Delete(ctx, record.ID, dns.RecordDeleteParams{ZoneID: cf.F(zone.ID)})
+		return err
+	})
+	successMessage(fmt.Sprintf("已创建 CNAME 记录 %s -> %s。", hostname, target))
+	return nil
+}
+
+// recordParam returns the parameters recreating an A, AAAA or CNAME record.
+func recordParam(record dns.RecordResponse) dns.RecordUnionParam {
+	switch record.Type {
+	case dns.RecordResponseTypeA:
+		return dns.ARecordParam{
+			Name:    cf.F(record.Name),
+			Content: cf.F(record.Content),
+			Proxied: cf.F(record.Proxied),
+			TTL:     cf.F(record.TTL),
+			Comment: cf.F(record.Comment),
+			Type:    cf.F(dns.ARecordTypeA),
+		}
+	case dns.RecordResponseTypeAAAA:
+		return dns.AAAARecordParam{
+			Name:    cf.F(record.Name),
+			Content: cf.F(record.Content),
+			Proxied: cf.F(record.Proxied),
+			TTL:     cf.F(record.TTL),
+			Comment: cf.F(record.Comment),
+			Type:    cf.F(dns.AAAARecordTypeAAAA),
+		}
+	default:
+		return dns.CNAMERecordParam{
+			Name:    cf.F(record.Name),
+			Content: cf.F(record.Content),
+			Proxied: cf.F(record.Proxied),
+			TTL:     cf.F(record.TTL),
+			Comment: cf.F(record.Comment),
+			Type:    cf.F(dns.CNAMERecordTypeCNAME),
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4/zones"
+)
+
+func TestMatchZone(t *testing.T) {
+	accountZones := []zones.Zone{
+		{ID: "1", Name: "example.com"},
+		{ID: "2", Name: "sub.example.com"},
+		{ID: "3", Name: "example.co.uk"},
+	}
+
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"example.com", "1"},
+		{"panel.example.com", "1"},
+		{"Panel.Example.COM.", "1"},
+		{"panel.sub.example.com", "2"},
+		{"sub.example.com", "2"},
+		{"panel.example.co.uk", "3"},
+		{"myexample.com", ""},
+		{"example.org", ""},
+		{"co.uk", ""},
+	}
+
+	for _, tt := range tests {
+		var got string
+		if zone := matchZone(accountZones, tt.hostname); zone != nil {
+			got = zone.ID
+		}
+
+		if got != tt.want {
+			t.Errorf("matchZone(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
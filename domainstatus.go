@@ -0,0 +1,199 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"net"
+	"time"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/pages"
+	"github.com/cloudflare/cloudflare-go/v4/workers"
+)
+
+const (
+	domainPollInterval = 10 * time.Second
+
+	stageDNS    = "dns"
+	stageSSL    = "ssl"
+	stageActive = "active"
+)
+
+var (
+	domainTimeout = 15 * time.Minute
+	panelTimeout  = 10 * time.Minute
+)
+
+// domainState is where a custom domain is on its way to serving the panel.
+type domainState struct {
+	Stage  string `json:"stage"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	failed bool
+}
+
+func (s domainState) active() bool {
+	return s.Stage == stageActive
+}
+
+func stageName(stage string) string {
+	switch stage {
+	case stageDNS:
+		return "DNS 验证"
+	case stageSSL:
+		return "SSL 证书"
+	default:
+		return "域名状态"
+	}
+}
+
+// addDomainFlags registers the timeouts of waiting for a new panel.
+func addDomainFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&domainTimeout, "domain-timeout", domainTimeout, "How long to wait for custom domains to become active")
+	fs.DurationVar(&panelTimeout, "panel-timeout", panelTimeout, "How long to wait for the deployed panel to respond")
+}
+
+// pagesDomainState reads the verification (DNS) and validation (SSL) state
+// Pages reports for a custom domain.
+func pagesDomainState(ctx context.Context, projectName, hostname string) (domainState, error) {
+	domain, err := cfClient.Pages.Projects.Domains.Get(ctx, projectName, hostname, pages.ProjectDomainGetParams{
+		AccountID: cf.F(cfAccount.ID),
+	})
+	if err != nil {
+		return domainState{}, fmt.Errorf("error getting pages domain: %w", err)
+	}
+
+	switch domain.Status {
+	case pages.ProjectDomainGetResponseStatusActive:
+		return domainState{Stage: stageActive, Status: string(domain.Status)}, nil
+	case pages.ProjectDomainGetResponseStatusError, pages.ProjectDomainGetResponseStatusBlocked, pages.ProjectDomainGetResponseStatusDeactivated:
+		return domainState{
+			Stage:  stageActive,
+			Status: string(domain.Status),
+			Error:  cmp.Or(domain.VerificationData.ErrorMessage, domain.ValidationData.ErrorMessage),
+			failed: true,
+		}, nil
+	}
+
+	if domain.VerificationData.Status != pages.ProjectDomainGetResponseVerificationDataStatusActive {
+		return domainState{
+			Stage:  stageDNS,
+			Status: cmp.Or(string(domain.VerificationData.Status), string(domain.Status)),
+			Error:  domain.VerificationData.ErrorMessage,
+		}, nil
+	}
+
+	return domainState{
+		Stage:  stageSSL,
+		Status: cmp.Or(string(domain.ValidationData.Status), string(domain.Status)),
+		Error:  domain.ValidationData.ErrorMessage,
+	}, nil
+}
+
+// workerDomainState checks a Workers custom domain. Cloudflare does not
+// report its certificate state, so the domain counts as active once it
+// resolves and serves a valid certificate.
+func workerDomainState(ctx context.Context, script, hostname string) (domainState, error) {
+	res, err := cfClient.Workers.Domains.List(ctx, workers.DomainListParams{
+		AccountID: cf.F(cfAccount.ID),
+		Service:   cf.F(script),
+		Hostname:  cf.F(hostname),
+	})
+	if err != nil {
+		return domainState{}, fmt.Errorf("error listing worker domains: %w", err)
+	}
+
+	if len(res.Result) == 0 {
+		return domainState{Stage: stageActive, Status: "missing", Error: "the custom domain is no longer attached to the worker", failed: true}, nil
+	}
+
+	if _, err := publicResolver.LookupHost(ctx, hostname); err != nil {
+		return domainState{Stage: stageDNS, Status: "pending", Error: err.Error()}, nil
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 10 * time.Second, Resolver: publicResolver},
+		Config:    &tls.Config{ServerName: hostname},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, "443"))
+	if err != nil {
+		return domainState{Stage: stageSSL, Status: "pending", Error: err.Error()}, nil
+	}
+	conn.Close()
+
+	return domainState{Stage: stageActive, Status: "active"}, nil
+}
+
+// waitForDomain polls the state of a custom domain until it is active,
+// printing every change with the time elapsed so far.
+func waitForDomain(ctx context.Context, hostname string, state func(ctx context.Context) (domainState, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, domainTimeout)
+	defer cancel()
+
+	fmt.Printf("\n%s 等待自定义域名 %s 生效...\n", title, fmtStr(hostname, GREEN, true))
+	emitStep("domain", StatusStarted, map[string]any{"domain": hostname})
+
+	start := time.Now()
+	ticker := time.NewTicker(domainPollInterval)
+	defer ticker.Stop()
+
+	var last domainState
+	for {
+		current, err := state(ctx)
+		elapsed := time.Since(start).Round(time.Second)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			fmt.Printf("%s [%s] 获取域名状态失败: %v\n", warning, elapsed, err)
+		case err == nil && current != last:
+			last = current
+			fmt.Printf("%s [%s] %s: %s\n", info, elapsed, stageName(current.Stage), fmtStr(current.Status, ORANGE, true))
+			if current.Error != "" {
+				fmt.Printf("%s Cloudflare: %s\n", warning, current.Error)
+			}
+			emitStep("domain", StatusStarted, map[string]any{"domain": hostname, "state": current, "elapsed": elapsed.Seconds()})
+		}
+
+		if current.failed {
+			err := fmt.Errorf("custom domain %s is %s: %s", hostname, current.Status, cmp.Or(current.Error, "no details"))
+			emitStepError("domain", err)
+			return err
+		}
+
+		if current.active() {
+			successMessage(fmt.Sprintf("自定义域名 %s 已生效，用时 %s。", hostname, elapsed))
+			emitStep("domain", StatusSucceeded, map[string]any{"domain": hostname, "elapsed": elapsed.Seconds()})
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			err := fmt.Errorf("custom domain %s not active after %s, last state %s/%s", hostname, domainTimeout, last.Stage, last.Status)
+			emitStepError("domain", err)
+			return err
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForCustomDomains waits until every custom domain of a new panel is
+// active, so the health check does not poll a domain that cannot work yet.
+func waitForCustomDomains(ctx context.Context, deployType DeployType, name string, customDomains []string) error {
+	for _, hostname := range customDomains {
+		state := func(ctx context.Context) (domainState, error) {
+			if deployType == DTPage {
+				return pagesDomainState(ctx, name, hostname)
+			}
+
+			return workerDomainState(ctx, name, hostname)
+		}
+
+		if err := waitForDomain(ctx, hostname, state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
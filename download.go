@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const (
+	ErrKindDNS     = "dns"
+	ErrKindConnect = "connect"
+	ErrKindTLS     = "tls"
+	ErrKindHTTP    = "http"
+	ErrKindTimeout = "timeout"
+	ErrKindNetwork = "network"
+	ErrKindFile    = "file"
+)
+
+var (
+	connectTimeout  = 15 * time.Second
+	readTimeout     = 30 * time.Second
+	downloadRetries = 4
+	errReadTimeout  = errors.New("no data received within the read timeout")
+	errPartChanged  = errors.New("the file changed on the server since the partial download")
+)
+
+// downloadClient is used for every GitHub request. It bounds connecting and
+// waiting for response headers, so a blocked host fails fast and callers can
+// fall back to mirrors, the cache or the bundle.
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:  connectTimeout,
+			Resolver: publicResolver,
+		}).DialContext,
+		TLSHandshakeTimeout:   connectTimeout,
+		ResponseHeaderTimeout: readTimeout,
+	},
+}
+
+// DownloadError is a failed download with the kind of failure, so users can
+// tell a blocked DNS lookup from a certificate problem or a missing file.
+type DownloadError struct {
+	Kind       string
+	URL        string
+	StatusCode int
+	Err        error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("%s error downloading %s: %v", e.Kind, e.URL, e.Err)
+}
+
+func (e *DownloadError) Unwrap() error {
+	return e.Err
+}
+
+// retryable reports whether trying the same URL again may help.
+func (e *DownloadError) retryable() bool {
+	switch e.Kind {
+	case ErrKindTLS, ErrKindFile:
+		return false
+	case ErrKindHTTP:
+		switch e.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusRequestedRangeNotSatisfiable:
+			return true
+		}
+
+		return e.StatusCode >= 500
+	default:
+		return true
+	}
+}
+
+// downloadErrorMessage describes err for the user, by category when known.
+func downloadErrorMessage(err error) string {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr.message()
+	}
+
+	return "下载失败"
+}
+
+func (e *DownloadError) message() string {
+	switch e.Kind {
+	case ErrKindDNS:
+		return "域名解析失败"
+	case ErrKindConnect:
+		return "无法建立连接"
+	case ErrKindTLS:
+		return "TLS 证书或握手错误"
+	case ErrKindHTTP:
+		return fmt.Sprintf("服务器返回 HTTP %d", e.StatusCode)
+	case ErrKindTimeout:
+		return "连接超时"
+	case ErrKindFile:
+		return "写入文件失败"
+	default:
+		return "网络错误"
+	}
+}
+
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *httpStatusError) Error() string {
+	return e.Status
+}
+
+func classifyDownloadError(url string, err error) *DownloadError {
+	var downloadErr *DownloadError
+	if errors.As(err, &downloadErr) {
+		return downloadErr
+	}
+
+	result := &DownloadError{Kind: ErrKindNetwork, URL: url, Err: err}
+	var dnsErr *net.DNSError
+	var statusErr *httpStatusError
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var opErr *net.OpError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &statusErr):
+		result.Kind, result.StatusCode = ErrKindHTTP, statusErr.StatusCode
+	case errors.As(err, &dnsErr):
+		result.Kind = ErrKindDNS
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		result.Kind = ErrKindTLS
+	case errors.Is(err, errReadTimeout), errors.Is(err, context.DeadlineExceeded):
+		result.Kind = ErrKindTimeout
+	case errors.As(err, &netErr) && netErr.Timeout():
+		result.Kind = ErrKindTimeout
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		result.Kind = ErrKindConnect
+	}
+
+	return result
+}
+
+// partPath returns where the partial download of url is kept: in the cache
+// directory, named by a hash of url, so a later run can resume it and data
+// from another source is never appended to it. The ETag or Last-Modified of
+// the download is kept next to it, see fetchPart.
+func partPath(url, dest string) string {
+	sum := sha256.Sum256([]byte(url))
+	name := hex.EncodeToString(sum[:8]) + ".part"
+	dir, err := cacheDir()
+	if err != nil {
+		return dest + "." + name
+	}
+
+	dir = filepath.Join(dir, "downloads")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return dest + "." + name
+	}
+
+	return filepath.Join(dir, name)
+}
+
+// downloadFile downloads url to dest. Data goes to a part file first and is
+// moved into place only when complete; interrupted transfers are resumed
+// with Range requests, also in later runs, and retried with exponential
+// backoff. A transfer fails once no data arrives for idleTimeout, however
+// long it has been running.
+func downloadFile(url, dest string, idleTimeout time.Duration) error {
+	part := partPath(url, dest)
+
+	var lastErr *DownloadError
+	for attempt := 0; attempt <= downloadRetries; attempt++ {
+		if attempt > 0 {
+			delay := min(time.Second<<(attempt-1), 10*time.Second)
+			fmt.Printf("%s %s，%s 后重试（%d/%d）...\n", info, lastErr.message(), delay, attempt, downloadRetries)
+			time.Sleep(delay)
+		}
+
+		err := fetchPart(context.Background(), url, part, idleTimeout)
+		if err == nil {
+			return movePart(url, part, dest)
+		}
+
+		lastErr = classifyDownloadError(url, err)
+		if !lastErr.retryable() {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+// movePart moves a completed part file to dest, copying it when they are on
+// different file systems.
+func movePart(url, part, dest string) error {
+	defer os.Remove(part + ".validator")
+	if err := os.Rename(part, dest); err == nil {
+		return nil
+	}
+
+	if err := copyFile(part, dest); err != nil {
+		return &DownloadError{Kind: ErrKindFile, URL: url, Err: err}
+	}
+
+	os.Remove(part)
+	return nil
+}
+
+// responseValidator returns what identifies the content of resp for an
+// If-Range request: a strong ETag, else the Last-Modified date.
+func responseValidator(resp *http.Response) string {
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+
+	return resp.Header.Get("Last-Modified")
+}
+
+// removePart deletes a part file that cannot be resumed.
+func removePart(part string) {
+	os.Remove(part)
+	os.Remove(part + ".validator")
+}
+
+// fetchPart downloads the rest of url into part, resuming after the bytes
+// already in it when the server supports ranges. URLs like
+// releases/latest/download serve other content after a release, so a part
+// is only resumed with If-Range and the validator saved when it was started;
+// a part without one, or whose content changed, is downloaded again.
+func fetchPart(ctx context.Context, url, part string, idleTimeout time.Duration) error {
+	var offset int64
+	var validator string
+	if stat, err := os.Stat(part); err == nil {
+		if data, err := os.ReadFile(part + ".validator"); err == nil && len(data) > 0 {
+			offset, validator = stat.Size(), string(data)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &DownloadError{Kind: ErrKindNetwork, URL: url, Err: err}
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		req.Header.Set("If-Range", validator)
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// A server ignoring If-Range may still send the range of new content.
+		if current := responseValidator(resp); current != "" && current != validator {
+			removePart(part)
+			return errPartChanged
+		}
+
+		flags |= os.O_APPEND
+	case resp.StatusCode == http.StatusOK:
+		flags |= os.O_TRUNC
+		offset = 0
+		if current := responseValidator(resp); current != "" {
+			if err := os.WriteFile(part+".validator", []byte(current), 0o644); err != nil {
+				return &DownloadError{Kind: ErrKindFile, URL: url, Err: err}
+			}
+		} else {
+			os.Remove(part + ".validator")
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file is already complete, or no longer matches the file
+		// on the server; start over in the latter case.
+		if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return nil
+		}
+
+		removePart(part)
+		return &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	default:
+		return &httpStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	out, err := os.OpenFile(part, flags, 0o644)
+	if err != nil {
+		return &DownloadError{Kind: ErrKindFile, URL: url, Err: err}
+	}
+	defer out.Close()
+
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+
+	progress := newProgressBar(total, offset)
+	body := &idleReader{r: resp.Body, timeout: idleTimeout, timer: time.AfterFunc(idleTimeout, func() {
+		cancel(errReadTimeout)
+	})}
+	defer body.timer.Stop()
+
+	_, err = io.Copy(io.MultiWriter(out, progress), body)
+	progress.finish(err == nil)
+	if err != nil {
+		if cause := context.Cause(ctx); errors.Is(cause, errReadTimeout) {
+			return errReadTimeout
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// idleReader pushes back its timer on every read, so the timer only fires
+// when the connection stalls.
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.timeout)
+	return r.r.Read(p)
+}
+
+// progressBar shows download progress, redrawing one line on a terminal and
+// printing a line every 25% otherwise.
+type progressBar struct {
+	total   int64
+	current int64
+	isTTY   bool
+	drawn   time.Time
+	step    int64
+}
+
+func newProgressBar(total, current int64) *progressBar {
+	fd := os.Stdout.Fd()
+	return &progressBar{
+		total:   total,
+		current: current,
+		isTTY:   !jsonOutput && (isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)),
+	}
+}
+
+func (p *progressBar) Write(b []byte) (int, error) {
+	p.current += int64(len(b))
+	if p.isTTY {
+		if time.Since(p.drawn) >= 100*time.Millisecond {
+			p.draw()
+		}
+	} else if p.total > 0 {
+		if step := p.current * 4 / p.total; step > p.step {
+			p.step = step
+			fmt.Printf("%s 已下载 %d%% (%s)\n", info, p.current*100/p.total, formatBytes(p.current))
+		}
+	}
+
+	return len(b), nil
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	if p.total <= 0 {
+		fmt.Printf("\r%s 已下载 %s", info, formatBytes(p.current))
+		return
+	}
+
+	const width = 30
+	filled := int(p.current * width / p.total)
+	fmt.Printf("\r%s [%s%s] %3d%% %s/%s", info, strings.Repeat("#", filled), strings.Repeat(".", width-filled), p.current*100/p.total, formatBytes(p.current), formatBytes(p.total))
+}
+
+func (p *progressBar) finish(ok bool) {
+	if !p.isTTY {
+		return
+	}
+
+	if ok {
+		p.draw()
+	}
+	fmt.Println()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return strconv.FormatFloat(float64(n)/(1<<20), 'f', 1, 64) + " MB"
+	case n >= 1<<10:
+		return strconv.FormatFloat(float64(n)/(1<<10), 'f', 1, 64) + " KB"
+	default:
+		return strconv.FormatInt(n, 10) + " B"
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	oldContent = []byte(strings.Repeat("old release worker.js\n", 200))
+	newContent = []byte(strings.Repeat("new release worker.js\n", 200))
+)
+
+// contentServer serves content with etag and records the Range header of
+// every request.
+func contentServer(t *testing.T, content []byte, etag string, ranges *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*ranges = append(*ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "worker.js", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writePart leaves a part file like an interrupted earlier run would.
+func writePart(t *testing.T, data []byte, validator string) string {
+	part := filepath.Join(t.TempDir(), "worker.js.part")
+	if err := os.WriteFile(part, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if validator != "" {
+		if err := os.WriteFile(part+".validator", []byte(validator), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return part
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestFetchPart(t *testing.T) {
+	tests := []struct {
+		name          string
+		part          []byte
+		validator     string
+		content       []byte
+		etag          string
+		wantRange     string
+		wantValidator string
+	}{
+		{"fresh download", nil, "", newContent, `"v2"`, "", `"v2"`},
+		{"resume", newContent[:100], `"v2"`, newContent, `"v2"`, "bytes=100-", `"v2"`},
+		{"complete part", newContent, `"v2"`, newContent, `"v2"`, "bytes=" + strconv.Itoa(len(newContent)) + "-", `"v2"`},
+		{"changed content", oldContent[:100], `"v1"`, newContent, `"v2"`, "bytes=100-", `"v2"`},
+		{"part without validator", oldContent[:100], "", newContent, `"v2"`, "", `"v2"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []string
+			server := contentServer(t, tt.content, tt.etag, &ranges)
+			part := filepath.Join(t.TempDir(), "worker.js.part")
+			if tt.part != nil {
+				part = writePart(t, tt.part, tt.validator)
+			}
+
+			if err := fetchPart(t.Context(), server.URL, part, 5*time.Second); err != nil {
+				t.Fatalf("fetchPart() = %v", err)
+			}
+
+			if got := readFile(t, part); !bytes.Equal(got, tt.content) {
+				t.Errorf("part holds %d bytes starting %q, want the %d bytes served", len(got), got[:min(len(got), 22)], len(tt.content))
+			}
+
+			if len(ranges) != 1 || ranges[0] != tt.wantRange {
+				t.Errorf("requested ranges %q, want [%q]", ranges, tt.wantRange)
+			}
+
+			if got := string(readFile(t, part+".validator")); got != tt.wantValidator {
+				t.Errorf("validator = %q, want %q", got, tt.wantValidator)
+			}
+		})
+	}
+}
+
+func TestFetchPartIgnoredIfRange(t *testing.T) {
+	// A server that answers every range request with the range of its current
+	// content must not get that appended to the old head.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del("If-Range")
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "worker.js", time.Time{}, bytes.NewReader(newContent))
+	}))
+	defer server.Close()
+
+	part := writePart(t, oldContent[:100], `"v1"`)
+	if err := fetchPart(t.Context(), server.URL, part, 5*time.Second); !errors.Is(err, errPartChanged) {
+		t.Fatalf("fetchPart() = %v, want %v", err, errPartChanged)
+	}
+
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Errorf("stale part file was kept: %v", err)
+	}
+
+	if err := fetchPart(t.Context(), server.URL, part, 5*time.Second); err != nil {
+		t.Fatalf("fetchPart() after restart = %v", err)
+	}
+
+	if got := readFile(t, part); !bytes.Equal(got, newContent) {
+		t.Errorf("part holds %d bytes, want the %d new bytes", len(got), len(newContent))
+	}
+}
+
+func TestDownloadFileResumesAcrossRuns(t *testing.T) {
+	useTempCache(t)
+	var ranges []string
+	server := contentServer(t, newContent, `"v2"`, &ranges)
+	url := server.URL + "/releases/latest/download/worker.js"
+	dest := filepath.Join(t.TempDir(), "worker.js")
+
+	part := partPath(url, dest)
+	if err := os.WriteFile(part, newContent[:300], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(part+".validator", []byte(`"v2"`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadFile(url, dest, 5*time.Second); err != nil {
+		t.Fatalf("downloadFile() = %v", err)
+	}
+
+	if got := readFile(t, dest); !bytes.Equal(got, newContent) {
+		t.Errorf("dest holds %d bytes, want %d", len(got), len(newContent))
+	}
+
+	if len(ranges) != 1 || ranges[0] != "bytes=300-" {
+		t.Errorf("requested ranges %q, want a resume after 300 bytes", ranges)
+	}
+
+	for _, path := range []string{part, part + ".validator"} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s was left behind: %v", filepath.Base(path), err)
+		}
+	}
+}
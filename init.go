@@ -7,9 +7,12 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -41,29 +44,28 @@ func checkAndroid() {
 	}
 }
 
+// publicResolver looks names up at a public DNS server, so a stale or
+// filtering local resolver does not hide a record that is already live.
+var publicResolver = &net.Resolver{
+	PreferGo: true,
+	Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+		d := net.Dialer{Timeout: 5 * time.Second}
+		return d.DialContext(ctx, "udp", "8.8.8.8:53")
+	},
+}
+
+// setDNS makes the default transport, used by the Cloudflare and OAuth
+// clients, resolve names with publicResolver. Dial errors are returned, so a
+// failed call reaches the retry prompts and the rollback of a creation.
 func setDNS() {
 	http.DefaultTransport.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-		d := net.Dialer{
-			Resolver: &net.Resolver{
-				PreferGo: true,
-				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-					conn, err := net.Dial("udp", "8.8.8.8:53")
-					if err != nil {
-						failMessage("Failed to dial DNS. Please disconnect your VPN and try again...")
-						log.Fatal(err)
-					}
-					return conn, nil
-				},
-			},
-		}
+		d := net.Dialer{Timeout: connectTimeout, Resolver: publicResolver}
 		conn, err := d.DialContext(ctx, network, addr)
 		if err != nil {
-			failMessage("DNS resolution failed. Please disconnect your VPN and try again...")
-			log.Fatal(err)
+			return nil, fmt.Errorf("error connecting to %s, disconnect your VPN and try again: %w", addr, err)
 		}
 		return conn, nil
 	}
-
 }
 
 func renderHeader() {
@@ -88,7 +90,43 @@ func initPaths() {
 	}
 
 	workerPath = filepath.Join(srcPath, "worker.js")
-	cachePath = filepath.Join(srcPath, "tld.cache")
+}
+
+// handleSignals removes the per-run temp directory when the wizard is
+// interrupted, like at a prompt or during a download. While a panel is being
+// created, resources.handleInterrupt rolls back first and exits itself.
+func handleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for range signals {
+			if resources.handlingInterrupts() {
+				continue
+			}
+
+			fmt.Println()
+			exit(130)
+		}
+	}()
+}
+
+// cleanupPaths removes the per-run temp directory.
+func cleanupPaths() {
+	if srcPath != "" {
+		os.RemoveAll(srcPath)
+	}
+}
+
+// exit ends the process with code after removing the per-run temp directory.
+func exit(code int) {
+	cleanupPaths()
+	os.Exit(code)
+}
+
+// fatal is log.Fatalln that also removes the per-run temp directory.
+func fatal(v ...any) {
+	cleanupPaths()
+	log.Fatalln(v...)
 }
 
 func fmtStr(str string, color string, isBold bool) string {
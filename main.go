@@ -1,62 +1,45 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"log"
-	"net/http"
 	"os"
-	"sync"
-	"time"
 )
 
 var (
 	srcPath    string
 	workerPath string
-	cachePath  string
 	isAndroid  = false
-	workerURL  = "https://github.com/zatursure/BPB-Worker-Panel-Chinese/releases/latest/download/worker.js"
 	VERSION    = "dev"
 )
 
-func init() {
+// setup parses the flags and prepares the run. It is not an init function,
+// so that tests do not parse the flags of the test binary.
+func setup() {
 	showVersion := flag.Bool("version", false, "Show version")
+	flag.Usage = usage
+	addLoginFlags(flag.CommandLine)
+	addWorkerFlags(flag.CommandLine)
+	addUpdateFlags(flag.CommandLine)
+	addSecretFlags(flag.CommandLine)
+	addDomainFlags(flag.CommandLine)
 	flag.Parse()
 	if *showVersion {
 		fmt.Println(VERSION)
+		if hasBundle() {
+			fmt.Println(bundleInfo())
+		}
 		os.Exit(0)
 	}
 
 	initPaths()
+	handleSignals()
 	setDNS()
 	checkAndroid()
 }
 
 func main() {
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	go func() {
-		defer wg.Done()
-		runWizard()
-	}()
-
-	server := &http.Server{Addr: ":8976"}
-	http.HandleFunc("/oauth/callback", callback)
-
-	go func() {
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			failMessage("本地服务器启动出错。")
-			log.Fatalln(err)
-		}
-	}()
-
-	wg.Wait()
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("服务器被强制关闭: %v", err)
-	}
+	setup()
+	runCommand(flag.Args())
+	cleanupPaths()
 }
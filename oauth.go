@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	_ "embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"html/template"
 	"log"
-	"math/rand/v2"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	cf "github.com/cloudflare/cloudflare-go/v4"
 	"github.com/cloudflare/cloudflare-go/v4/accounts"
@@ -16,49 +26,125 @@ import (
 	"golang.org/x/oauth2"
 )
 
+var (
+	errLoginTimeout = errors.New("timed out waiting for the browser login")
+	errInvalidState = errors.New("invalid oauth state")
+	errStateExpired = errors.New("oauth state expired, please start the login again")
+	errMissingCode  = errors.New("no authorization code returned")
+	errAccessDenied = errors.New("access denied on the Cloudflare consent screen")
+)
+
 //go:embed static/index.html
-var indexHTML []byte
+var indexHTML string
+
+var indexTemplate = template.Must(template.New("index").Parse(indexHTML))
+
+type loginResult struct {
+	token *oauth2.Token
+	err   error
+}
 
 var (
-	cfClient      *cf.Client
-	cfAccount     *accounts.Account
-	state         string
-	codeVerifier  string
-	obtainedToken = make(chan *oauth2.Token)
-	config        = &oauth2.Config{
-		ClientID:     "54d11594-84e4-41aa-b438-e81b8fa78ee7",
+	cfClient     *cf.Client
+	cfAccount    *accounts.Account
+	pending      pendingLogin
+	loginResults = make(chan loginResult, 1)
+	callbackPort = 8976
+	loginTimeout = 5 * time.Minute
+	noBrowser    bool
+	revokeURL    = envOr("BPB_OAUTH_REVOKE_URL", "https://dash.cloudflare.com/oauth2/revoke")
+	config       = &oauth2.Config{
+		ClientID:     envOr("BPB_OAUTH_CLIENT_ID", "54d11594-84e4-41aa-b438-e81b8fa78ee7"),
 		ClientSecret: "",
 		RedirectURL:  "http://localhost:8976/oauth/callback",
 		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://dash.cloudflare.com/oauth2/auth",
-			TokenURL: "https://dash.cloudflare.com/oauth2/token",
-		},
-		Scopes: []string{
-			"account:read", "user:read", "workers:write", "workers_kv:write",
-			"workers_routes:write", "workers_scripts:write", "workers_tail:read",
-			"d1:write", "pages:write", "pages:read", "zone:read", "ssl_certs:write",
-			"ai:write", "queues:write", "pipelines:write", "secrets_store:write",
+			AuthURL:  envOr("BPB_OAUTH_AUTH_URL", "https://dash.cloudflare.com/oauth2/auth"),
+			TokenURL: envOr("BPB_OAUTH_TOKEN_URL", "https://dash.cloudflare.com/oauth2/token"),
 		},
+		Scopes: defaultScopes(),
 	}
 )
 
-func NewClient(token *oauth2.Token) *cf.Client {
-	return cf.NewClient(option.WithAPIToken(token.AccessToken))
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
 }
 
-func getAccount(ctx context.Context) (*accounts.Account, error) {
-	res, err := cfClient.Accounts.List(ctx, accounts.AccountListParams{})
-	if err != nil {
-		return nil, fmt.Errorf("error listing accounts - %v", err)
+func defaultScopes() []string {
+	if value := os.Getenv("BPB_OAUTH_SCOPES"); value != "" {
+		return splitScopes(value)
+	}
+
+	return []string{
+		"account:read", "user:read", "workers:write", "workers_kv:write",
+		"workers_routes:write", "workers_scripts:write", "workers_tail:read",
+		"d1:write", "pages:write", "pages:read", "zone:read", "dns_records:write",
+		"ssl_certs:write", "ai:write", "queues:write", "pipelines:write",
+		"secrets_store:write",
+	}
+}
+
+// oauthContext makes the oauth2 package talk to the token endpoint through
+// downloadClient, so a network failure during the code exchange or a token
+// refresh fails fast and is returned instead of hanging the login.
+func oauthContext() context.Context {
+	return context.WithValue(context.Background(), oauth2.HTTPClient, downloadClient)
+}
+
+// splitScopes accepts scopes separated by commas and/or spaces.
+func splitScopes(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// pendingLogin holds the state and PKCE verifier of the login attempt in
+// progress. The state can be redeemed only once and only until it expires.
+type pendingLogin struct {
+	mu       sync.Mutex
+	state    string
+	verifier string
+	expires  time.Time
+}
+
+func (p *pendingLogin) start(state, verifier string, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.state, p.verifier, p.expires = state, verifier, time.Now().Add(ttl)
+}
+
+// redeem checks state against the pending one in constant time and, when it
+// matches, consumes it and returns the code verifier.
+func (p *pendingLogin) redeem(state string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(p.state)) != 1 {
+		return "", errInvalidState
+	}
+
+	verifier := p.verifier
+	expired := time.Now().After(p.expires)
+	p.state, p.verifier = "", ""
+	if expired {
+		return "", errStateExpired
 	}
 
-	return &res.Result[0], nil
+	return verifier, nil
+}
+
+func NewClient(token *oauth2.Token) *cf.Client {
+	return cf.NewClient(option.WithAPIToken(token.AccessToken))
 }
 
 func generateAuthURL() string {
-	state = generateState()
-	codeVerifier = generateCodeVerifier()
+	state := generateState()
+	codeVerifier := generateCodeVerifier()
 	codeChallenge := generateCodeChallenge(codeVerifier)
+	pending.start(state, codeVerifier, loginTimeout)
 
 	return config.AuthCodeURL(
 		state,
@@ -69,22 +155,13 @@ func generateAuthURL() string {
 }
 
 func generateState() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	buff := make([]byte, 16)
-
-	for i := range buff {
-		buff[i] = charset[rand.Int64()%int64(len(charset))]
-	}
-
-	return base64.URLEncoding.EncodeToString(buff)
+	return rand.Text()
 }
 
 func generateCodeVerifier() string {
 	b := make([]byte, 32)
-
-	for i := range b {
-		b[i] = byte(rand.IntN(256))
-	}
+	// crypto/rand.Read never returns an error, it aborts the program instead.
+	_, _ = rand.Read(b)
 
 	return base64.RawURLEncoding.EncodeToString(b)
 }
@@ -94,43 +171,250 @@ func generateCodeChallenge(verifier string) string {
 	return base64.RawURLEncoding.EncodeToString(hash[:])
 }
 
-func login() {
+// login runs the browser authorization flow, offering to retry when it fails
+// or times out.
+func login() (*oauth2.Token, error) {
+	for {
+		token, err := loginOnce()
+		if err == nil {
+			return token, nil
+		}
+
+		if errors.Is(err, errLoginTimeout) {
+			failMessage(fmt.Sprintf("%s 内未完成浏览器登录。", loginTimeout))
+		} else {
+			failMessage("登录失败。")
+			log.Printf("%v\n", err)
+		}
+
+		if !confirm("是否重新登录？(y/n): ", false) {
+			return nil, err
+		}
+	}
+}
+
+func loginOnce() (*oauth2.Token, error) {
+	// Drop a result left over from an earlier attempt.
+	select {
+	case <-loginResults:
+	default:
+	}
+
+	if noBrowser {
+		port := callbackPort
+		if port == 0 {
+			port = 8976
+		}
+
+		config.RedirectURL = fmt.Sprintf("http://localhost:%d/oauth/callback", port)
+		return pasteLogin(generateAuthURL())
+	}
+
+	server, err := startCallbackServer()
+	if err != nil {
+		return nil, err
+	}
+
 	url := generateAuthURL()
 	fmt.Printf("\n%s 登录 %s...\n", title, fmtStr("Cloudflare", ORANGE, true))
 
 	if err := openURL(url); err != nil {
-		failMessage("登录失败。")
-		log.Fatalln(err)
+		stopCallbackServer(server)
+		failMessage("无法打开浏览器，改为手动登录。")
+		log.Printf("%v\n", err)
+		return pasteLogin(url)
+	}
+	defer stopCallbackServer(server)
+
+	select {
+	case result := <-loginResults:
+		return result.token, result.err
+	case <-time.After(loginTimeout):
+		return nil, errLoginTimeout
 	}
 }
 
-func callback(w http.ResponseWriter, r *http.Request) {
-	param := r.URL.Query().Get("state")
-	if param != state {
-		failMessage("无效的 OAuth 状态。")
-		return
+// pasteLogin lets the user open the authorization URL on any device and paste
+// back the address the browser was redirected to, for headless and SSH use.
+func pasteLogin(authURL string) (*oauth2.Token, error) {
+	if assumeYes {
+		return nil, fmt.Errorf("manual login needs an interactive terminal, use --api-token instead")
 	}
 
-	code := r.URL.Query().Get("code")
+	fmt.Printf("\n%s 请在任意设备的浏览器中打开以下地址并登录 %s:\n\n%s\n\n", title, fmtStr("Cloudflare", ORANGE, true), authURL)
+	fmt.Printf("%s 授权后浏览器会跳转到 %s 开头的地址，即使页面无法打开也没关系。\n", info, fmtStr(config.RedirectURL, GREEN, true))
+	fmt.Printf("%s 请复制地址栏中的完整地址并粘贴到下方。\n\n", info)
+
+	for {
+		response := promptUser("请粘贴跳转后的完整地址: ")
+		redirect, err := url.Parse(response)
+		if err != nil || response == "" {
+			failMessage("地址无效，请重试。")
+			continue
+		}
+
+		token, err := exchangeCode(redirect.Query())
+		if err != nil {
+			failMessage(loginErrorMessage(err))
+			if errors.Is(err, errInvalidState) {
+				log.Printf("%v\n", err)
+				continue
+			}
+
+			return nil, err
+		}
+
+		successMessage("Cloudflare 登录成功！")
+		return token, nil
+	}
+}
+
+// exchangeCode validates the parameters Cloudflare redirected back with and
+// completes the PKCE exchange using the stored code verifier. The state is
+// checked first, so a redirect that does not belong to this login attempt
+// cannot end it.
+func exchangeCode(query url.Values) (*oauth2.Token, error) {
+	codeVerifier, err := pending.redeem(query.Get("state"))
+	if err != nil {
+		return nil, err
+	}
+
+	if oauthErr := query.Get("error"); oauthErr != "" {
+		if oauthErr == "access_denied" {
+			return nil, errAccessDenied
+		}
+
+		return nil, fmt.Errorf("cloudflare returned %s: %s", oauthErr, query.Get("error_description"))
+	}
+
+	code := query.Get("code")
 	if code == "" {
-		failMessage("未返回授权码。")
-		return
+		return nil, errMissingCode
 	}
 
 	token, err := config.Exchange(
-		context.Background(),
+		oauthContext(),
 		code,
 		oauth2.SetAuthURLParam("code_verifier", codeVerifier),
 	)
+	if err != nil {
+		return nil, fmt.Errorf("error exchanging oauth code: %w", err)
+	}
+
+	return token, nil
+}
+
+func loginErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errInvalidState):
+		return "无效的 OAuth 状态。"
+	case errors.Is(err, errStateExpired):
+		return "登录链接已过期，请重新登录。"
+	case errors.Is(err, errMissingCode):
+		return "未返回授权码。"
+	case errors.Is(err, errAccessDenied):
+		return "你在 Cloudflare 授权页面拒绝了授权。"
+	default:
+		return "交换 oauthToken 失败。"
+	}
+}
+
+// startCallbackServer listens for the OAuth redirect on the loopback interface
+// only, and points the redirect URL at the port actually bound.
+func startCallbackServer() (*http.Server, error) {
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(callbackPort))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error listening on %s, use --callback-port to pick another port (0 for any free port): %w", addr, err)
+	}
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	config.RedirectURL = fmt.Sprintf("http://localhost:%d/oauth/callback", port)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/callback", callback)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			failMessage("本地服务器启动出错。")
+			log.Println(err)
+		}
+	}()
 
+	return server, nil
+}
+
+func stopCallbackServer(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("服务器被强制关闭: %v", err)
+	}
+}
+
+func callback(w http.ResponseWriter, r *http.Request) {
+	if !isLoopbackRequest(r) {
+		log.Printf("rejected oauth callback from %s (host %q)\n", r.RemoteAddr, r.Host)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	token, err := exchangeCode(r.URL.Query())
 	if err != nil {
-		failMessage("交换 oauthToken 失败。")
-		log.Fatalln(err)
+		failMessage(loginErrorMessage(err))
+		renderLoginPage(w, http.StatusBadRequest, loginErrorMessage(err))
+	} else {
+		successMessage("Cloudflare 登录成功！")
+		renderLoginPage(w, http.StatusOK, "")
 	}
 
-	obtainedToken <- token
-	successMessage("Cloudflare 登录成功！")
+	// A callback with a foreign state (e.g. a browser reload after the state
+	// was used) is answered but does not end the login attempt.
+	if errors.Is(err, errInvalidState) {
+		return
+	}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(indexHTML)
+	// Only the first callback of a login attempt is delivered.
+	select {
+	case loginResults <- loginResult{token: token, err: err}:
+	default:
+	}
+}
+
+// isLoopbackRequest reports whether r comes from this machine and was sent to
+// a loopback host name, which also keeps DNS rebinding pages out.
+func isLoopbackRequest(r *http.Request) bool {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	if ip := net.ParseIP(remote); ip == nil || !ip.IsLoopback() {
+		return false
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func renderLoginPage(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := indexTemplate.Execute(w, struct{ Error string }{message}); err != nil {
+		log.Printf("%v\n", err)
+	}
 }
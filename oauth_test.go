@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPendingLoginRedeem(t *testing.T) {
+	var p pendingLogin
+	if _, err := p.redeem(""); !errors.Is(err, errInvalidState) {
+		t.Errorf("redeem without a login = %v, want %v", err, errInvalidState)
+	}
+
+	p.start("state", "verifier", time.Minute)
+	if _, err := p.redeem("other"); !errors.Is(err, errInvalidState) {
+		t.Errorf("redeem(wrong state) = %v, want %v", err, errInvalidState)
+	}
+
+	verifier, err := p.redeem("state")
+	if err != nil || verifier != "verifier" {
+		t.Errorf("redeem(state) = %q, %v, want %q", verifier, err, "verifier")
+	}
+
+	if _, err := p.redeem("state"); !errors.Is(err, errInvalidState) {
+		t.Errorf("second redeem(state) = %v, want %v", err, errInvalidState)
+	}
+
+	p.start("state", "verifier", -time.Second)
+	if _, err := p.redeem("state"); !errors.Is(err, errStateExpired) {
+		t.Errorf("redeem(expired state) = %v, want %v", err, errStateExpired)
+	}
+
+	if _, err := p.redeem("state"); !errors.Is(err, errInvalidState) {
+		t.Errorf("redeem after expiry = %v, want %v", err, errInvalidState)
+	}
+}
+
+func TestIsLoopbackRequest(t *testing.T) {
+	tests := []struct {
+		remote string
+		host   string
+		want   bool
+	}{
+		{"127.0.0.1:51234", "localhost:8976", true},
+		{"127.0.0.1:51234", "127.0.0.1:8976", true},
+		{"[::1]:51234", "[::1]:8976", true},
+		{"127.0.0.1:51234", "LOCALHOST", true},
+		{"192.168.1.5:51234", "localhost:8976", false},
+		{"127.0.0.1:51234", "evil.example.com:8976", false},
+		{"127.0.0.1:51234", "192.168.1.5:8976", false},
+		{"not-an-address", "localhost:8976", false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/oauth/callback", nil)
+		r.RemoteAddr = tt.remote
+		r.Host = tt.host
+		if got := isLoopbackRequest(r); got != tt.want {
+			t.Errorf("isLoopbackRequest(remote %s, host %s) = %t, want %t", tt.remote, tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	StatusStarted   = "started"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusSkipped   = "skipped"
+)
+
+var (
+	jsonOutput bool
+	eventOut   io.Writer = os.Stdout
+)
+
+// Event is a single line of the --output json stream.
+type Event struct {
+	Time   time.Time      `json:"time"`
+	Event  string         `json:"event"`
+	Step   string         `json:"step,omitempty"`
+	Status string         `json:"status,omitempty"`
+	Error  string         `json:"error,omitempty"`
+	Data   map[string]any `json:"data,omitempty"`
+}
+
+func setOutputMode(mode string) error {
+	switch mode {
+	case "", "text":
+		return nil
+	case "json":
+	default:
+		return fmt.Errorf("invalid output mode %q, expected text or json", mode)
+	}
+
+	// Human readable messages and prompts are moved to stderr so that stdout
+	// only carries one JSON event per line.
+	jsonOutput = true
+	eventOut = os.Stdout
+	os.Stdout = os.Stderr
+	return nil
+}
+
+func writeEvent(event Event) {
+	if !jsonOutput {
+		return
+	}
+
+	event.Time = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error marshalling event: %v\n", err)
+		return
+	}
+
+	fmt.Fprintln(eventOut, string(data))
+}
+
+func emitStep(step string, status string, data map[string]any) {
+	writeEvent(Event{Event: "step", Step: step, Status: status, Data: data})
+}
+
+func emitStepError(step string, err error) {
+	event := Event{Event: "step", Step: step, Status: StatusFailed}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	writeEvent(event)
+}
+
+func emitResult(data map[string]any) {
+	writeEvent(Event{Event: "result", Data: data})
+}
+
+func emitFieldError(fe fieldError) {
+	writeEvent(Event{Event: "validation_error", Error: strings.TrimSpace(fe.Err.Error()), Data: map[string]any{"field": fe.Field}})
+}
+
+func emitError(err error) {
+	writeEvent(Event{Event: "error", Error: err.Error()})
+}
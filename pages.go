@@ -4,13 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/textproto"
 	"os"
-	"strings"
 	"time"
 
 	cf "github.com/cloudflare/cloudflare-go/v4"
@@ -20,11 +20,12 @@ import (
 )
 
 type projectDeploymentNewParams struct {
-	AccountID string                `form:"account_id,required"`
-	Branch    string                `form:"branch"`
-	Manifest  string                `form:"manifest"`
-	WorkerJS  *multipart.FileHeader `form:"_worker.js"`
-	jsPath    string
+	AccountID     string                `form:"account_id,required"`
+	Branch        string                `form:"branch"`
+	Manifest      string                `form:"manifest"`
+	CommitMessage string                `form:"commit_message"`
+	WorkerJS      *multipart.FileHeader `form:"_worker.js"`
+	jsPath        string
 }
 
 func (pdp projectDeploymentNewParams) MarshalMultipart() ([]byte, string, error) {
@@ -58,6 +59,14 @@ func (pdp projectDeploymentNewParams) MarshalMultipart() ([]byte, string, error)
 		return nil, "", fmt.Errorf("error writing branch content: %w", err)
 	}
 
+	// Pages keeps the commit message of every deployment, which is where
+	// the deployed panel version is recorded.
+	if pdp.CommitMessage != "" {
+		if err := writer.WriteField("commit_message", pdp.CommitMessage); err != nil {
+			return nil, "", fmt.Errorf("error writing commit message: %w", err)
+		}
+	}
+
 	fileHeaders := textproto.MIMEHeader{
 		"Content-Disposition": []string{`form-data; name="_worker.js"; filename="_worker.js"`},
 		"Content-Type":        []string{"application/javascript"},
@@ -118,26 +127,11 @@ func createPagesProject(
 							},
 						}),
 						EnvVars: cf.F(map[string]pages.ProjectDeploymentConfigsProductionEnvVarsUnionParam{
-							"UUID": pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
-								Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
-								Value: cf.F(uid),
-							},
-							"TR_PASS": pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
-								Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
-								Value: cf.F(pass),
-							},
-							"PROXY_IP": pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
-								Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
-								Value: cf.F(proxy),
-							},
-							"FALLBACK": pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
-								Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
-								Value: cf.F(fallback),
-							},
-							"SUB_PATH": pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
-								Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
-								Value: cf.F(sub),
-							},
+							"UUID":     pagesEnvVar("UUID", uid),
+							"TR_PASS":  pagesEnvVar("TR_PASS", pass),
+							"PROXY_IP": pagesEnvVar("PROXY_IP", proxy),
+							"FALLBACK": pagesEnvVar("FALLBACK", fallback),
+							"SUB_PATH": pagesEnvVar("SUB_PATH", sub),
 						}),
 					}),
 				}),
@@ -153,11 +147,12 @@ func createPagesProject(
 
 func createPagesDeployment(ctx context.Context, project *pages.Project) (*pages.Deployment, error) {
 	param := projectDeploymentNewParams{
-		AccountID: cfAccount.ID,
-		Branch:    "main",
-		Manifest:  "{}",
-		WorkerJS:  &multipart.FileHeader{Filename: "worker.js"},
-		jsPath:    workerPath,
+		AccountID:     cfAccount.ID,
+		Branch:        "main",
+		Manifest:      "{}",
+		CommitMessage: deployMessage(),
+		WorkerJS:      &multipart.FileHeader{Filename: "worker.js"},
+		jsPath:        workerPath,
 	}
 	data, ct, err := param.MarshalMultipart()
 	if err != nil {
@@ -179,59 +174,66 @@ func createPagesDeployment(ctx context.Context, project *pages.Project) (*pages.
 	return deployment, nil
 }
 
-func addPagesProjectCustomDomain(ctx context.Context, projectName string, customDomain string) (string, error) {
-	// extractor, err := tldextract.New(cachePath, false)
-	// if err != nil {
-	// 	return "", fmt.Errorf("error extracting TLD: %w", err)
-	// }
-
-	// result := extractor.Extract(customDomain)
-	// domain := fmt.Sprintf("%s.%s", result.Root, result.Tld)
-
-	// zones, err := cfClient.Zones.List(ctx, zones.ZoneListParams{
-	// 	Account: cf.F(zones.ZoneListParamsAccount{
-	// 		ID: cf.F(cfAccount.ID),
-	// 	}),
-	// 	Match: cf.F(zones.ZoneListParamsMatch("contains")),
-	// 	Name:  cf.F(domain),
-	// })
-
-	// if err != nil {
-	// 	return "", err
-	// }
-
-	// if len(zones.Result) == 0 {
-	// 	message := fmt.Sprintf("Could not find this domain in your account: %s", domain)
-	// 	return "", fmt.Errorf(message, nil)
-	// }
-
-	// zone := zones.Result[0]
-	// pagesHost := fmt.Sprintf("%s.pages.dev", projectName)
-
-	// _, er := cfClient.DNS.Records.New(ctx, dns.RecordNewParams{
-	// 	ZoneID: cf.F(zone.ID),
-	// 	Record: dns.CNAMERecordParam{
-	// 		Content: cf.F(pagesHost),
-	// 		Name:    cf.F(customDomain),
-	// 		Proxied: cf.F(true),
-	// 		Type:    cf.F(dns.CNAMERecordType("CNAME")),
-	// 	},
-	// }, cfClient.Options...)
-
-	// if er != nil {
-	// 	return "", er
-	// }
-
-	res, err := cfClient.Pages.Projects.Domains.New(ctx, projectName, pages.ProjectDomainNewParams{
+func addPagesProjectCustomDomain(ctx context.Context, projectName string, customDomain string) error {
+	_, err := cfClient.Pages.Projects.Domains.New(ctx, projectName, pages.ProjectDomainNewParams{
 		AccountID: cf.F(cfAccount.ID),
 		Name:      cf.F(customDomain),
 	})
 
 	if err != nil {
-		return "", fmt.Errorf("error adding custom domain to pages: %w", err)
+		return fmt.Errorf("error adding custom domain to pages: %w", err)
 	}
 
-	return res.Name, nil
+	return nil
+}
+
+// addPagesDomainCNAME points customDomain at the project with a proxied CNAME
+// when its zone is on this account. It reports whether the CNAME still has to
+// be created by hand, which is the case when the zone is elsewhere or the user
+// kept conflicting records.
+func addPagesDomainCNAME(ctx context.Context, projectName string, customDomain string) (bool, error) {
+	zone, err := findZone(ctx, customDomain)
+	if errors.Is(err, errZoneNotFound) {
+		fmt.Printf("%s %s 的域名不在当前账号中，无法自动创建 DNS 记录。\n", info, customDomain)
+		log.Printf("%v\n", err)
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	err = ensureCNAME(ctx, zone, customDomain, projectName+".pages.dev")
+	if errors.Is(err, errRecordsKept) {
+		log.Printf("%v\n", err)
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+func deletePagesCustomDomain(ctx context.Context, projectName string, customDomain string) error {
+	_, err := cfClient.Pages.Projects.Domains.Delete(ctx, projectName, customDomain, pages.ProjectDomainDeleteParams{
+		AccountID: cf.F(cfAccount.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("error detaching custom domain: %w", err)
+	}
+
+	return nil
+}
+
+func getPagesProject(ctx context.Context, projectName string) (*pages.Project, error) {
+	project, err := cfClient.Pages.Projects.Get(ctx, projectName, pages.ProjectGetParams{AccountID: cf.F(cfAccount.ID)})
+	if err != nil {
+		return nil, fmt.Errorf("error getting pages project: %w", err)
+	}
+
+	return project, nil
 }
 
 func isPagesProjectAvailable(ctx context.Context, projectName string) bool {
@@ -314,11 +316,12 @@ func updatePagesProject(ctx context.Context, projectName string) error {
 	}
 
 	param := projectDeploymentNewParams{
-		AccountID: cfAccount.ID,
-		Branch:    "main",
-		Manifest:  "{}",
-		WorkerJS:  &multipart.FileHeader{Filename: "worker.js"},
-		jsPath:    workerPath,
+		AccountID:     cfAccount.ID,
+		Branch:        "main",
+		Manifest:      "{}",
+		CommitMessage: deployMessage(),
+		WorkerJS:      &multipart.FileHeader{Filename: "worker.js"},
+		jsPath:        workerPath,
 	}
 	data, ct, err := param.MarshalMultipart()
 	if err != nil {
@@ -349,7 +352,8 @@ func deployPagesProject(
 	fallback string,
 	sub string,
 	kvNamespace *kv.Namespace,
-	customDomain string,
+	customDomains []string,
+	isNew bool,
 ) (
 	panelURL string,
 	er error,
@@ -359,54 +363,105 @@ func deployPagesProject(
 
 	for {
 		fmt.Printf("\n%s 正在创建 Pages 项目...\n", title)
+		emitStep("pages_project", StatusStarted, nil)
 
 		project, err = createPagesProject(ctx, name, uid, pass, proxy, fallback, sub, kvNamespace)
 		if err != nil {
 			failMessage("创建项目失败。")
 			log.Printf("%v\n\n", err)
-			if response := promptUser("是否重试？(y/n): "); strings.ToLower(response) == "n" {
-				return "", nil
+			emitStepError("pages_project", err)
+			if !confirm("是否重试？(y/n): ", false) {
+				return "", err
 			}
 			continue
 		}
 
+		// An overwritten panel and its domains were there before, so they are
+		// not rolled back.
+		if isNew {
+			resources.add("pages_project", "Pages 项目", name, func(ctx context.Context) error {
+				return deletePagesProject(ctx, name)
+			})
+		} else {
+			// The overwritten panel is bound to the new KV namespace now.
+			resources.keep("kv_namespace")
+		}
 		successMessage("Page 创建成功！")
+		emitStep("pages_project", StatusSucceeded, nil)
 		break
 	}
 
 	for {
 		fmt.Printf("\n%s 正在部署 Pages 项目...\n", title)
+		emitStep("pages_deploy", StatusStarted, nil)
 
 		_, err = createPagesDeployment(ctx, project)
 		if err != nil {
 			failMessage("部署项目失败。")
 			log.Printf("%v\n\n", err)
-			if response := promptUser("是否重试？(y/n): "); strings.ToLower(response) == "n" {
-				return "", nil
+			emitStepError("pages_deploy", err)
+			if !confirm("是否重试？(y/n): ", false) {
+				return "", err
 			}
 			continue
 		}
 
 		successMessage("Page 部署成功！")
+		emitStep("pages_deploy", StatusSucceeded, nil)
 		break
 	}
 
-	if customDomain != "" {
+	for _, customDomain := range customDomains {
+		emitStep("custom_domain", StatusStarted, map[string]any{"domain": customDomain})
 		for {
-			recordName, err := addPagesProjectCustomDomain(ctx, name, customDomain)
-			if err != nil {
+			if err := addPagesProjectCustomDomain(ctx, name, customDomain); err != nil {
 				failMessage("添加自定义域名失败。")
 				log.Printf("%v\n\n", err)
-				if response := promptUser("是否重试？(y/n): "); strings.ToLower(response) == "n" {
-					return "", nil
+				emitStepError("custom_domain", err)
+				if !confirm("是否重试？(y/n): ", false) {
+					return "", err
+				}
+				continue
+			}
+
+			break
+		}
+
+		if isNew {
+			resources.add("pages_domain", "自定义域名", customDomain, func(ctx context.Context) error {
+				return deletePagesCustomDomain(ctx, name, customDomain)
+			})
+		}
+		successMessage("自定义域名添加成功！")
+
+		var needsCNAME bool
+		for {
+			var err error
+			needsCNAME, err = addPagesDomainCNAME(ctx, name, customDomain)
+			if err != nil {
+				failMessage("自动创建 CNAME 记录失败。")
+				log.Printf("%v\n\n", err)
+				emitStepError("custom_domain", err)
+				if !confirm("是否重试？(y/n): ", false) {
+					return "", err
 				}
 				continue
 			}
 
-			successMessage("自定义域名添加成功！")
-			fmt.Printf("%s %s: 你需要为 Name: %s 和 Target: %s 创建 CNAME 记录，否则自定义域名将无法生效。\n", info, warning, fmtStr(recordName, GREEN, true), fmtStr(name+".pages.dev", GREEN, true))
-			return "https://" + customDomain + "/panel", nil
+			break
+		}
+
+		emitStep("custom_domain", StatusSucceeded, map[string]any{"domain": customDomain, "cname_created": !needsCNAME})
+		if needsCNAME {
+			fmt.Printf("%s %s: 你需要为 Name: %s 和 Target: %s 创建 CNAME 记录，否则自定义域名将无法生效。\n", info, warning, fmtStr(customDomain, GREEN, true), fmtStr(name+".pages.dev", GREEN, true))
 		}
+		if panelURL == "" {
+			panelURL = "https://" + customDomain + "/panel"
+		}
+	}
+
+	if panelURL != "" {
+		return panelURL, nil
 	}
 
 	successMessage("访问面板大约需要 5 分钟，请耐心等待...")
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// deployPrefix starts the Pages deployment message naming the panel version.
+const deployPrefix = "BPB panel "
+
+var (
+	forceUpdate bool
+
+	// preparedVersion is the panel version of the worker.js at workerPath,
+	// empty when unknown.
+	preparedVersion string
+
+	scriptVersionRegex = regexp.MustCompile("(?i)panel_?version[\"'`\\]]*\\s*[:=]\\s*[\"'`]v?(\\d+(?:\\.\\d+){1,3}(?:-[0-9a-z.]+)?)[\"'`]")
+	deployVersionRegex = regexp.MustCompile(regexp.QuoteMeta(deployPrefix) + `(\S+)`)
+)
+
+// addUpdateFlags registers the flags of panel updates.
+func addUpdateFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&forceUpdate, "force", forceUpdate, "Update even when the panel already runs the target version or it would be a downgrade")
+}
+
+// scriptVersion extracts the panel version embedded in a worker.js.
+func scriptVersion(script []byte) string {
+	match := scriptVersionRegex.FindSubmatch(script)
+	if match == nil {
+		return ""
+	}
+
+	return "v" + string(match[1])
+}
+
+// releaseVersion returns the panel version of the prepared worker.js: the
+// release tag, or the version embedded in the script when the tag does not
+// name one.
+func releaseVersion(release *Release) string {
+	if _, ok := parseVersion(release.TagName); ok {
+		return release.TagName
+	}
+
+	script, err := os.ReadFile(workerPath)
+	if err != nil {
+		return ""
+	}
+
+	return scriptVersion(script)
+}
+
+func deployMessage() string {
+	if preparedVersion == "" {
+		return ""
+	}
+
+	return deployPrefix + preparedVersion
+}
+
+// deployedVersion returns the panel version currently running on panel,
+// empty when it cannot be told. Workers scripts are downloaded and searched
+// for the version; Pages only keep the message of each deployment, which the
+// wizard fills with the version it deploys.
+func deployedVersion(ctx context.Context, panel Panel) (string, error) {
+	if panel.Type == "workers" {
+		script, err := getWorkerScript(ctx, panel.Name)
+		if err != nil {
+			return "", err
+		}
+
+		return scriptVersion(script), nil
+	}
+
+	project, err := getPagesProject(ctx, panel.Name)
+	if err != nil {
+		return "", err
+	}
+
+	deployment := project.CanonicalDeployment
+	if deployment.ID == "" {
+		deployment = project.LatestDeployment
+	}
+
+	match := deployVersionRegex.FindStringSubmatch(deployment.DeploymentTrigger.Metadata.CommitMessage)
+	if match == nil {
+		return "", nil
+	}
+
+	return match[1], nil
+}
+
+type version struct {
+	numbers    [4]int
+	prerelease string
+}
+
+// parseVersion parses tags like v3.0.1 and 3.1.0-beta.2.
+func parseVersion(tag string) (version, bool) {
+	var v version
+	tag = strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	tag, v.prerelease, _ = strings.Cut(tag, "-")
+	parts := strings.Split(tag, ".")
+	if len(parts) < 2 || len(parts) > len(v.numbers) {
+		return v, false
+	}
+
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+
+		v.numbers[i] = n
+	}
+
+	return v, true
+}
+
+// compareVersions compares two version tags like cmp.Compare. ok is false
+// when either is not a version.
+func compareVersions(a, b string) (result int, ok bool) {
+	va, okA := parseVersion(a)
+	vb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	for i := range va.numbers {
+		if c := cmp.Compare(va.numbers[i], vb.numbers[i]); c != 0 {
+			return c, true
+		}
+	}
+
+	// A pre-release comes before the release it leads up to.
+	switch {
+	case va.prerelease == vb.prerelease:
+		return 0, true
+	case va.prerelease == "":
+		return 1, true
+	case vb.prerelease == "":
+		return -1, true
+	default:
+		return comparePrerelease(va.prerelease, vb.prerelease), true
+	}
+}
+
+// comparePrerelease orders pre-release tags like semver: dot separated
+// identifiers are compared one by one, numerically when both are numbers, and
+// numbers come before words. So beta.2 < beta.10 and alpha < beta < rc.
+func comparePrerelease(a, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+	for i := range min(len(partsA), len(partsB)) {
+		numA, errA := strconv.ParseUint(partsA[i], 10, 64)
+		numB, errB := strconv.ParseUint(partsB[i], 10, 64)
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = cmp.Compare(numA, numB)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(partsA[i], partsB[i])
+		}
+
+		if c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(partsA), len(partsB))
+}
+
+// printChangelog prints the notes of the releases after current up to
+// target, newest first. Pre-releases are left out on the stable channel.
+func printChangelog(ctx context.Context, current, target, channel string) {
+	releases, err := listReleases(ctx)
+	if err != nil {
+		fmt.Printf("%s 无法获取更新说明: %v\n", warning, err)
+		return
+	}
+
+	var shown []Release
+	reachedCurrent := false
+	for _, release := range releases {
+		after, ok := compareVersions(release.TagName, current)
+		if !ok {
+			continue
+		}
+
+		if after <= 0 {
+			reachedCurrent = true
+			continue
+		}
+
+		if upTo, _ := compareVersions(release.TagName, target); upTo > 0 {
+			continue
+		}
+
+		if release.Prerelease && channel != ChannelPrerelease && release.TagName != target {
+			continue
+		}
+
+		shown = append(shown, release)
+	}
+
+	if len(shown) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%s %s 到 %s 的更新说明:\n", title, fmtStr(current, ORANGE, true), fmtStr(target, GREEN, true))
+	for _, release := range shown {
+		fmt.Printf("\n %s %s\n", fmtStr(release.TagName, GREEN, true), release.PublishedAt.Format("2006-01-02"))
+		notes := strings.TrimSpace(release.Body)
+		if notes == "" {
+			notes = "（无更新说明）"
+		}
+
+		for line := range strings.Lines(notes) {
+			fmt.Printf("   %s", line)
+		}
+		fmt.Println()
+	}
+
+	if !reachedCurrent && len(releases) >= releasesToShow {
+		fmt.Printf("\n%s 仅显示最近的 %d 个版本，完整更新记录见 https://github.com/%s/releases\n", info, releasesToShow, workerRepo)
+	}
+	fmt.Println()
+}
+
+// confirmUpdate compares the deployed and the target version, shows what
+// changes and reports whether to go on. Updating to the same version or
+// downgrading needs --force or a confirmation, which --yes does not give.
+func confirmUpdate(ctx context.Context, panel Panel, current, target, channel string) bool {
+	data := map[string]any{"current_version": current, "target_version": target}
+	if current == "" {
+		fmt.Printf("%s 无法识别 %s 当前部署的版本。\n", info, fmtStr(panel.Name, GREEN, true))
+		emitStep("version_check", StatusSkipped, data)
+		return true
+	}
+
+	fmt.Printf("%s 当前版本: %s，目标版本: %s\n", info, fmtStr(current, ORANGE, true), fmtStr(cmp.Or(target, "未知"), GREEN, true))
+	order, ok := compareVersions(target, current)
+	if !ok {
+		emitStep("version_check", StatusSkipped, data)
+		return true
+	}
+
+	emitStep("version_check", StatusSucceeded, data)
+	switch {
+	case order == 0:
+		fmt.Printf("%s %s 已经是 %s 版本。\n", warning, panel.Name, current)
+		return forceUpdate || confirmStrict("是否仍要重新部署？(y/n): ", false)
+	case order < 0:
+		fmt.Printf("%s 将从 %s 降级到 %s。\n", warning, fmtStr(current, ORANGE, true), fmtStr(target, ORANGE, true))
+		return forceUpdate || confirmStrict("是否确认降级？(y/n): ", false)
+	default:
+		if !offline {
+			printChangelog(ctx, current, target, channel)
+		}
+		return true
+	}
+}
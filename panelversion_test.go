@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+		ok   bool
+	}{
+		{"v3.0.1", "v3.0.1", 0, true},
+		{"v3.0.1", "3.0.1", 0, true},
+		{"v3.1.0", "v3.0.9", 1, true},
+		{"v2.9", "v2.9.0", 0, true},
+		{"v3.0.10", "v3.0.9", 1, true},
+		{"v3.0.0-beta.1", "v3.0.0", -1, true},
+		{"v3.0.0", "v3.0.0-rc.1", 1, true},
+		{"v3.0.0-beta.2", "v3.0.0-beta.10", -1, true},
+		{"v3.0.0-alpha", "v3.0.0-beta", -1, true},
+		{"v3.0.0-beta", "v3.0.0-beta.1", -1, true},
+		{"v3.0.0-1", "v3.0.0-beta", -1, true},
+		{"v3.0.0-rc.1", "v3.0.0-beta.11", 1, true},
+		{"latest", "v3.0.0", 0, false},
+		{"v3", "v3.0.0", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("compareVersions(%q, %q) = %d, %t, want %d, %t", tt.a, tt.b, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestScriptVersion(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{`const panelVersion = "3.0.1";`, "v3.0.1"},
+		{`globalThis["panelVersion"]="4.1"`, "v4.1"},
+		{`var PANEL_VERSION = 'v2.9.1-beta.2'`, "v2.9.1-beta.2"},
+		{`export default { fetch() {} }`, ""},
+	}
+
+	for _, tt := range tests {
+		if got := scriptVersion([]byte(tt.script)); got != tt.want {
+			t.Errorf("scriptVersion(%q) = %q, want %q", tt.script, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	workerRepo     = "zatursure/BPB-Worker-Panel-Chinese"
+	workerAsset    = "worker.js"
+	latestVersion  = "latest"
+	releasesToShow = 10
+)
+
+var errReleaseNotFound = errors.New("release not found")
+
+var (
+	workerVersion string
+	githubToken   = os.Getenv("GITHUB_TOKEN")
+)
+
+// Release is the part of a GitHub release the wizard uses.
+type Release struct {
+	TagName     string         `json:"tag_name"`
+	Name        string         `json:"name"`
+	Body        string         `json:"body"`
+	Draft       bool           `json:"draft"`
+	Prerelease  bool           `json:"prerelease"`
+	PublishedAt time.Time      `json:"published_at"`
+	Assets      []ReleaseAsset `json:"assets"`
+
+	// source records where the deployed worker.js came from.
+	source string
+}
+
+type ReleaseAsset struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size"`
+	Digest      string `json:"digest"`
+	DownloadURL string `json:"browser_download_url"`
+}
+
+// addReleaseFlags registers the flags choosing which panel release to deploy.
+func addReleaseFlags(fs *flag.FlagSet) {
+	fs.StringVar(&workerVersion, "worker-version", workerVersion, "BPB panel release tag to deploy, e.g. v3.0.0 (default: choose interactively, latest with --yes)")
+	fs.Func("channel", "Release channel: stable or prerelease (default: the panel's saved channel, else stable)", func(value string) error {
+		channel, err := parseChannel(value)
+		releaseChannel = channel
+		return err
+	})
+	fs.Func("github-token", "GitHub token used for the releases API to avoid rate limits (env GITHUB_TOKEN)", func(value string) error {
+		githubToken = value
+		return nil
+	})
+}
+
+// workerDownloadURL returns the worker.js download address of a release tag
+// without going through the API, so downloads still work when it is blocked.
+func workerDownloadURL(tag string) string {
+	if tag == "" || tag == latestVersion {
+		return fmt.Sprintf("https://github.com/%s/releases/latest/download/%s", workerRepo, workerAsset)
+	}
+
+	return fmt.Sprintf("https://github.com/%s/releases/download/%s/%s", workerRepo, tag, workerAsset)
+}
+
+func githubGet(ctx context.Context, url string, v any) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if githubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+githubToken)
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error querying GitHub releases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: %s", errReleaseNotFound, url)
+	case (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests) && resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return fmt.Errorf("GitHub API rate limit exceeded, set GITHUB_TOKEN or --github-token")
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("error querying GitHub releases: %s", resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("error parsing GitHub response: %w", err)
+	}
+
+	return nil
+}
+
+func listReleases(ctx context.Context) ([]Release, error) {
+	var releases []Release
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=%d", workerRepo, releasesToShow)
+	if err := githubGet(ctx, url, &releases); err != nil {
+		return nil, err
+	}
+
+	published := releases[:0]
+	for _, release := range releases {
+		if !release.Draft {
+			published = append(published, release)
+		}
+	}
+
+	return published, nil
+}
+
+func getRelease(ctx context.Context, tag string) (*Release, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/tags/%s", workerRepo, tag)
+	if tag == latestVersion {
+		url = fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", workerRepo)
+	}
+
+	var release Release
+	if err := githubGet(ctx, url, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
+
+// asset returns the release asset with the given name.
+func (r *Release) asset(name string) (*ReleaseAsset, error) {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("release %s has no %s asset", r.TagName, name)
+}
+
+// workerURL returns where to download worker.js from for this release.
+func (r *Release) workerURL() string {
+	if asset, err := r.asset(workerAsset); err == nil && asset.DownloadURL != "" {
+		return asset.DownloadURL
+	}
+
+	return workerDownloadURL(r.TagName)
+}
+
+// summary returns the first meaningful line of the release notes.
+func (r *Release) summary() string {
+	for line := range strings.Lines(r.Body) {
+		line = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), "#*->"))
+		if line == "" {
+			continue
+		}
+
+		if runes := []rune(line); len(runes) > 60 {
+			line = string(runes[:60]) + "…"
+		}
+
+		return line
+	}
+
+	return ""
+}
+
+// latestRelease returns the newest release of channel. GitHub's "latest"
+// release never is a pre-release, so that channel needs the release list.
+func latestRelease(ctx context.Context, channel string) (*Release, error) {
+	if channel != ChannelPrerelease {
+		return getRelease(ctx, latestVersion)
+	}
+
+	releases, err := listReleases(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(releases) == 0 {
+		return nil, errReleaseNotFound
+	}
+
+	return &releases[0], nil
+}
+
+// resolveRelease decides which panel release to deploy: the --worker-version
+// tag, the newest release of channel with --yes, or the user's pick from the
+// release list. A --worker-file without a version is deployed as is, and
+// --offline prefers the bundled build. When the GitHub API is unreachable the
+// release is still downloaded from its fixed URL, only its notes are
+// unavailable.
+func resolveRelease(ctx context.Context, channel string) (*Release, error) {
+	if workerFile != "" && workerVersion == "" {
+		return localRelease(), nil
+	}
+
+	if offline {
+		if workerVersion == "" && hasBundle() {
+			return bundledRelease(), nil
+		}
+
+		return &Release{TagName: cmp.Or(workerVersion, latestVersion)}, nil
+	}
+
+	if workerVersion != "" && workerVersion != latestVersion {
+		release, err := getRelease(ctx, workerVersion)
+		if err != nil {
+			if errors.Is(err, errReleaseNotFound) {
+				return nil, fmt.Errorf("BPB panel release %s does not exist", workerVersion)
+			}
+
+			fmt.Printf("%s 无法获取版本信息，将直接下载 %s 版本。\n", info, fmtStr(workerVersion, GREEN, true))
+			log.Printf("%v\n", err)
+			return &Release{TagName: workerVersion}, nil
+		}
+
+		return release, nil
+	}
+
+	if workerVersion == latestVersion || assumeYes {
+		release, err := latestRelease(ctx, channel)
+		if err != nil {
+			fmt.Printf("%s 无法获取%s版本信息，将直接下载最新稳定版。\n", info, channelName(channel))
+			log.Printf("%v\n", err)
+			return &Release{TagName: latestVersion}, nil
+		}
+
+		return release, nil
+	}
+
+	releases, err := listReleases(ctx)
+	if err != nil || len(releases) == 0 {
+		fmt.Printf("%s 无法获取版本列表，将使用最新版本。\n", info)
+		if err != nil {
+			log.Printf("%v\n", err)
+		}
+		return &Release{TagName: latestVersion}, nil
+	}
+
+	return selectRelease(releases, channel), nil
+}
+
+func selectRelease(releases []Release, channel string) *Release {
+	defaultIndex := 0
+	for i, release := range releases {
+		if channel == ChannelPrerelease || !release.Prerelease {
+			defaultIndex = i
+			break
+		}
+	}
+
+	fmt.Printf("\n%s 可用的 %s 版本:\n\n", title, fmtStr("BPB 面板", GREEN, true))
+	for i, release := range releases {
+		marker := ""
+		if release.Prerelease {
+			marker = fmtStr(" (预发布)", ORANGE, false)
+		}
+		if i == defaultIndex {
+			marker += fmtStr(fmt.Sprintf(" (最新%s)", channelName(channel)), GREEN, true)
+		}
+
+		fmt.Printf(" %s %s %s%s\n", fmtStr(strconv.Itoa(i+1)+".", BLUE, true), fmtStr(release.TagName, ORANGE, true), release.PublishedAt.Format("2006-01-02"), marker)
+		if summary := release.summary(); summary != "" {
+			fmt.Printf("    %s\n", summary)
+		}
+	}
+
+	for {
+		fmt.Println("")
+		response := promptUser(fmt.Sprintf("请选择要部署的版本编号，或直接回车使用最新%s: ", channelName(channel)))
+		if response == "" {
+			return &releases[defaultIndex]
+		}
+
+		index, err := strconv.Atoi(response)
+		if err != nil || index < 1 || index > len(releases) {
+			failMessage("选择无效，请重试。")
+			continue
+		}
+
+		return &releases[index-1]
+	}
+}
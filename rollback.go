@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const rollbackTimeout = 2 * time.Minute
+
+// createdResource is something a panel creation made on the account, with
+// how to delete it again. Deleted resources are ones the creation removed,
+// like replaced DNS records, and undo recreates them.
+type createdResource struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Deleted bool   `json:"deleted,omitempty"`
+	label   string
+	undo    func(ctx context.Context) error
+}
+
+func (r createdResource) String() string {
+	return fmt.Sprintf("%s %s", r.label, fmtStr(r.Name, ORANGE, true))
+}
+
+// resourceTracker records the resources created by a panel creation, so a
+// failed or interrupted run can remove them instead of leaving orphans like
+// unused panel-kv-* namespaces behind.
+type resourceTracker struct {
+	// mu is held for the whole rollback, so the creation cannot go on while
+	// an interrupted run is being cleaned up.
+	mu        sync.Mutex
+	resources []createdResource
+	kept      []createdResource
+	done      bool
+
+	// interrupts is set while handleInterrupt is in charge of Ctrl-C.
+	interrupts atomic.Bool
+}
+
+var resources resourceTracker
+
+func (t *resourceTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resources = nil
+	t.kept = nil
+	t.done = false
+}
+
+func (t *resourceTracker) add(kind, label, name string, undo func(ctx context.Context) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resources = append(t.resources, createdResource{Kind: kind, Name: name, label: label, undo: undo})
+}
+
+// addDeleted records a resource the creation deleted, with how to restore it.
+func (t *resourceTracker) addDeleted(kind, label, name string, undo func(ctx context.Context) error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resources = append(t.resources, createdResource{Kind: kind, Name: name, Deleted: true, label: label, undo: undo})
+}
+
+// keep stops tracking the resources of kind, because a panel that was there
+// before this run now depends on them. Rollback reports them as kept.
+func (t *resourceTracker) keep(kind string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var tracked []createdResource
+	for _, resource := range t.resources {
+		if resource.Kind == kind {
+			t.kept = append(t.kept, resource)
+		} else {
+			tracked = append(tracked, resource)
+		}
+	}
+
+	t.resources = tracked
+}
+
+// commit keeps everything created so far; there is nothing left to roll back.
+func (t *resourceTracker) commit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.resources = nil
+	t.done = true
+}
+
+// rollback deletes the tracked resources, and restores the deleted ones, in
+// reverse order and prints what was undone and what could not be.
+func (t *resourceTracker) rollback() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done || len(t.resources) == 0 {
+		return
+	}
+
+	t.done = true
+	ctx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+
+	fmt.Printf("\n%s 回滚本次创建的资源...\n", title)
+	emitStep("rollback", StatusStarted, map[string]any{"resources": t.resources})
+
+	var removed, failed []createdResource
+	for i := len(t.resources) - 1; i >= 0; i-- {
+		resource := t.resources[i]
+		action := "删除"
+		if resource.Deleted {
+			action = "恢复"
+		}
+
+		if err := resource.undo(ctx); err != nil {
+			fmt.Printf(" %s %s %s 失败: %v\n", fmtStr("✗", RED, true), action, resource, err)
+			failed = append(failed, resource)
+			continue
+		}
+
+		fmt.Printf(" %s 已%s %s\n", fmtStr("✓", GREEN, true), action, resource)
+		removed = append(removed, resource)
+	}
+
+	for _, resource := range t.kept {
+		fmt.Printf(" %s 保留 %s，被覆盖的面板正在使用\n", info, resource)
+	}
+
+	data := map[string]any{"removed": removed, "failed": failed, "kept": t.kept}
+	if len(failed) > 0 {
+		failMessage(fmt.Sprintf("回滚未完成，%d 个资源需要在 Cloudflare 控制台中手动处理。", len(failed)))
+		writeEvent(Event{Event: "step", Step: "rollback", Status: StatusFailed, Error: "some resources could not be deleted", Data: data})
+		return
+	}
+
+	successMessage(fmt.Sprintf("回滚完成，已撤销 %d 个资源的变更。", len(removed)))
+	emitStep("rollback", StatusSucceeded, data)
+}
+
+// printKept lists the tracked resources when they are left on the account,
+// and the deleted ones that were not restored.
+func (t *resourceTracker) printKept() {
+	if len(t.resources) == 0 {
+		return
+	}
+
+	kept := slices.Clone(t.kept)
+	var deleted []createdResource
+	for _, resource := range t.resources {
+		if resource.Deleted {
+			deleted = append(deleted, resource)
+		} else {
+			kept = append(kept, resource)
+		}
+	}
+
+	if len(kept) > 0 {
+		fmt.Printf("\n%s 以下资源已保留，如不再需要请手动删除:\n", warning)
+		for _, resource := range kept {
+			fmt.Printf(" - %s\n", resource)
+		}
+	}
+
+	if len(deleted) > 0 {
+		fmt.Printf("\n%s 以下资源已被删除，如需要请手动恢复:\n", warning)
+		for _, resource := range deleted {
+			fmt.Printf(" - %s\n", resource)
+		}
+	}
+
+	emitStep("rollback", StatusSkipped, map[string]any{"resources": t.resources})
+}
+
+// abort is called when the creation fails. It offers to roll back, and does
+// so without asking with --yes, then exits.
+func (t *resourceTracker) abort(err error) {
+	t.mu.Lock()
+	pending := !t.done && len(t.resources) > 0
+	t.mu.Unlock()
+
+	if pending {
+		if confirm("是否删除本次已创建的资源？(y/n): ", true) {
+			t.rollback()
+		} else {
+			t.printKept()
+		}
+	}
+
+	fatal(err)
+}
+
+// handleInterrupt rolls back and exits when the run is interrupted with
+// Ctrl-C. A second Ctrl-C stops the rollback. The returned function stops
+// the handling once the creation is over.
+func (t *resourceTracker) handleInterrupt(cancel context.CancelFunc) (stop func()) {
+	t.interrupts.Store(true)
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	finished := make(chan struct{})
+
+	go func() {
+		select {
+		case <-signals:
+		case <-finished:
+			return
+		}
+
+		cancel()
+		fmt.Printf("\n%s 创建已中断，再次按 Ctrl-C 可跳过回滚。\n", warning)
+		go func() {
+			<-signals
+			log.Println("rollback interrupted")
+			exit(130)
+		}()
+
+		t.rollback()
+		exit(130)
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.interrupts.Store(false)
+			signal.Stop(signals)
+			close(finished)
+		})
+	}
+}
+
+func (t *resourceTracker) handlingInterrupts() bool {
+	return t.interrupts.Load()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestResourceTrackerRollback(t *testing.T) {
+	var undone []string
+	undo := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			undone = append(undone, name)
+			return err
+		}
+	}
+
+	var tracker resourceTracker
+	tracker.reset()
+	tracker.add("kv_namespace", "KV 命名空间", "kv", undo("kv", nil))
+	tracker.add("worker", "Worker", "worker", undo("worker", errors.New("boom")))
+	tracker.addDeleted("dns_record", "DNS 记录", "record", undo("record", nil))
+	tracker.add("dns_record", "DNS 记录", "cname", undo("cname", nil))
+
+	tracker.rollback()
+	if want := []string{"cname", "record", "worker", "kv"}; !slices.Equal(undone, want) {
+		t.Errorf("rollback undid %q, want %q", undone, want)
+	}
+
+	undone = nil
+	tracker.rollback()
+	if len(undone) != 0 {
+		t.Errorf("second rollback undid %q, want nothing", undone)
+	}
+}
+
+func TestResourceTrackerKeep(t *testing.T) {
+	var undone []string
+	undo := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			undone = append(undone, name)
+			return nil
+		}
+	}
+
+	var tracker resourceTracker
+	tracker.reset()
+	tracker.add("kv_namespace", "KV 命名空间", "kv", undo("kv"))
+	tracker.keep("kv_namespace")
+	tracker.add("worker_domain", "自定义域名", "panel.example.com", undo("domain"))
+
+	tracker.rollback()
+	if want := []string{"domain"}; !slices.Equal(undone, want) {
+		t.Errorf("rollback undid %q, want %q", undone, want)
+	}
+
+	if len(tracker.kept) != 1 || tracker.kept[0].Name != "kv" {
+		t.Errorf("kept = %v, want the KV namespace", tracker.kept)
+	}
+}
+
+func TestResourceTrackerCommit(t *testing.T) {
+	called := false
+	var tracker resourceTracker
+	tracker.reset()
+	tracker.add("kv_namespace", "KV 命名空间", "kv", func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	tracker.commit()
+	tracker.rollback()
+	if called {
+		t.Error("rollback after commit deleted a committed resource")
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"slices"
+	"strings"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+	"github.com/cloudflare/cloudflare-go/v4/pages"
+	"github.com/cloudflare/cloudflare-go/v4/workers"
+)
+
+// panelVars are the variables a panel is configured with, besides its KV
+// namespace.
+var panelVars = []string{"UUID", "TR_PASS", "PROXY_IP", "FALLBACK", "SUB_PATH"}
+
+var defaultSecretVars = []string{"UUID", "TR_PASS"}
+
+// secretVars is the --secret-vars list, nil when not given.
+var secretVars []string
+
+// addSecretFlags registers the flag choosing which panel variables are
+// stored as secrets.
+func addSecretFlags(fs *flag.FlagSet) {
+	fs.Func("secret-vars", fmt.Sprintf("Panel variables stored encrypted as secrets, comma separated, or \"none\" (default %s)", strings.Join(defaultSecretVars, ",")), func(value string) error {
+		vars, err := parseSecretVars(value)
+		secretVars = vars
+		return err
+	})
+}
+
+func parseSecretVars(value string) ([]string, error) {
+	vars := []string{}
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return vars, nil
+	}
+
+	for _, name := range splitList(value) {
+		name = strings.ToUpper(name)
+		if !slices.Contains(panelVars, name) {
+			return nil, fmt.Errorf("unknown panel variable %q, expected one of %s", name, strings.Join(panelVars, ", "))
+		}
+
+		vars = append(vars, name)
+	}
+
+	return vars, nil
+}
+
+// secretVarList returns the variables to store as secrets: --secret-vars,
+// then secret_vars in config.json, then the UUID and Trojan password.
+func secretVarList() []string {
+	if secretVars != nil {
+		return secretVars
+	}
+
+	if cfg, err := loadConfig(); err == nil && cfg.SecretVars != nil {
+		vars, err := parseSecretVars(strings.Join(cfg.SecretVars, ","))
+		if err == nil {
+			return vars
+		}
+
+		log.Printf("ignoring secret_vars in config.json: %v\n", err)
+	}
+
+	return defaultSecretVars
+}
+
+func isSecretVar(name string) bool {
+	return slices.Contains(secretVarList(), name)
+}
+
+// workerBinding returns the text binding of a panel variable.
+func workerBinding(name, value string) map[string]string {
+	binding := map[string]string{"name": name, "text": value, "type": "plain_text"}
+	if isSecretVar(name) {
+		binding["type"] = "secret_text"
+	}
+
+	return binding
+}
+
+// pagesEnvVar returns the Pages environment variable of a panel variable.
+func pagesEnvVar(name, value string) pages.ProjectDeploymentConfigsProductionEnvVarsUnionParam {
+	if isSecretVar(name) {
+		return pages.ProjectDeploymentConfigsProductionEnvVarsPagesSecretTextEnvVarParam{
+			Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesSecretTextEnvVarTypeSecretText),
+			Value: cf.F(value),
+		}
+	}
+
+	return pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarParam{
+		Type:  cf.F(pages.ProjectDeploymentConfigsProductionEnvVarsPagesPlainTextEnvVarTypePlainText),
+		Value: cf.F(value),
+	}
+}
+
+// migrateSecrets turns the panel variables of panel that should be secrets
+// but are still stored as plain text into secrets, keeping their values. It
+// returns the names of the migrated variables.
+func migrateSecrets(ctx context.Context, panel Panel) ([]string, error) {
+	if panel.Type == "workers" {
+		return migrateWorkerSecrets(ctx, panel.Name)
+	}
+
+	return migratePagesSecrets(ctx, panel.Name)
+}
+
+func migrateWorkerSecrets(ctx context.Context, name string) ([]string, error) {
+	current, err := getWorkerBindings(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The settings endpoint replaces all bindings. Those the wizard does not
+	// rewrite are passed as "inherit" to keep them as they are.
+	var migrated []string
+	var bindings []map[string]string
+	for _, binding := range current {
+		switch {
+		case binding.Type == "plain_text" && slices.Contains(panelVars, binding.Name) && isSecretVar(binding.Name):
+			bindings = append(bindings, map[string]string{"name": binding.Name, "text": binding.Text, "type": "secret_text"})
+			migrated = append(migrated, binding.Name)
+		case binding.Type == "plain_text":
+			bindings = append(bindings, map[string]string{"name": binding.Name, "text": binding.Text, "type": "plain_text"})
+		default:
+			bindings = append(bindings, map[string]string{"name": binding.Name, "type": "inherit"})
+		}
+	}
+
+	if len(migrated) == 0 {
+		return nil, nil
+	}
+
+	settings, err := json.Marshal(map[string]any{"bindings": bindings})
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling worker settings: %w", err)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.WriteField("settings", string(settings)); err != nil {
+		return nil, fmt.Errorf("error writing worker settings: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error closing multipart writer: %w", err)
+	}
+
+	_, err = cfClient.Workers.Scripts.ScriptAndVersionSettings.Edit(
+		ctx,
+		name,
+		workers.ScriptScriptAndVersionSettingEditParams{AccountID: cf.F(cfAccount.ID)},
+		option.WithRequestBody(writer.FormDataContentType(), body),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error updating worker bindings: %w", err)
+	}
+
+	return migrated, nil
+}
+
+func migratePagesSecrets(ctx context.Context, name string) ([]string, error) {
+	project, err := getPagesProject(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages merges the given variables into the existing ones.
+	var migrated []string
+	envVars := make(map[string]pages.ProjectDeploymentConfigsProductionEnvVarsUnionParam)
+	for varName, envVar := range project.DeploymentConfigs.Production.EnvVars {
+		if envVar.Type == "plain_text" && slices.Contains(panelVars, varName) && isSecretVar(varName) {
+			envVars[varName] = pagesEnvVar(varName, envVar.Value)
+			migrated = append(migrated, varName)
+		}
+	}
+
+	if len(migrated) == 0 {
+		return nil, nil
+	}
+
+	slices.Sort(migrated)
+	_, err = cfClient.Pages.Projects.Edit(ctx, name, pages.ProjectEditParams{
+		AccountID: cf.F(cfAccount.ID),
+		Project: pages.ProjectParam{
+			DeploymentConfigs: cf.F(pages.ProjectDeploymentConfigsParam{
+				Production: cf.F(pages.ProjectDeploymentConfigsProductionParam{
+					EnvVars: cf.F(envVars),
+				}),
+			}),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error updating pages environment variables: %w", err)
+	}
+
+	return migrated, nil
+}
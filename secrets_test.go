@@ -0,0 +1,28 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSecretVars(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"UUID,TR_PASS", []string{"UUID", "TR_PASS"}, false},
+		{" uuid , sub_path ", []string{"UUID", "SUB_PATH"}, false},
+		{"none", []string{}, false},
+		{" NONE ", []string{}, false},
+		{"", []string{}, false},
+		{"UUID,PASSWORD", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSecretVars(tt.value)
+		if (err != nil) != tt.wantErr || !slices.Equal(got, tt.want) {
+			t.Errorf("parseSecretVars(%q) = %q, %v, want %q, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	cf "github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+	"golang.org/x/oauth2"
+)
+
+var errNoSession = errors.New("no saved Cloudflare session")
+
+func tokenPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "token.json"), nil
+}
+
+func loadToken() (*oauth2.Token, error) {
+	path, err := tokenPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errNoSession
+		}
+		return nil, fmt.Errorf("error reading saved session: %w", err)
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("error parsing saved session: %w", err)
+	}
+
+	return &token, nil
+}
+
+func saveToken(token *oauth2.Token) error {
+	path, err := tokenPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("error marshalling session: %w", err)
+	}
+
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+
+	return nil
+}
+
+func deleteToken() error {
+	path, err := tokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error deleting saved session: %w", err)
+	}
+
+	return nil
+}
+
+// savingTokenSource persists every new token the wrapped source hands out,
+// so refreshed access and refresh tokens survive between runs.
+type savingTokenSource struct {
+	base oauth2.TokenSource
+	mu   sync.Mutex
+	last string
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.base.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if token.AccessToken != s.last {
+		s.last = token.AccessToken
+		if err := saveToken(token); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+
+	return token, nil
+}
+
+func newSessionClient(token *oauth2.Token) *cf.Client {
+	ts := &savingTokenSource{
+		base: config.TokenSource(oauthContext(), token),
+		last: token.AccessToken,
+	}
+
+	return cf.NewClient(option.WithHTTPClient(oauth2.NewClient(context.Background(), ts)))
+}
+
+// isSessionError reports whether err means the saved session can no longer be
+// used, as opposed to a transient network failure.
+func isSessionError(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return true
+	}
+
+	var apiErr *cf.Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden
+	}
+
+	return false
+}
+
+// loginWithOAuth reuses the saved session when it is still valid and falls
+// back to the browser login otherwise.
+func loginWithOAuth(ctx context.Context) error {
+	token, err := loadToken()
+	if err == nil {
+		cfClient = newSessionClient(token)
+		cfAccount, err = getAccount(ctx)
+		if err == nil {
+			successMessage("已使用保存的 Cloudflare 会话登录。")
+			return nil
+		}
+
+		if !isSessionError(err) {
+			return err
+		}
+
+		failMessage("保存的会话已失效，需要重新登录。")
+		if err := deleteToken(); err != nil {
+			log.Printf("%v\n", err)
+		}
+	} else if !errors.Is(err, errNoSession) {
+		log.Printf("%v\n", err)
+	}
+
+	return browserLogin(ctx)
+}
+
+func browserLogin(ctx context.Context) error {
+	token, err := login()
+	if err != nil {
+		return err
+	}
+
+	if err := saveToken(token); err != nil {
+		failMessage("保存会话失败，下次运行需要重新登录。")
+		log.Printf("%v\n", err)
+	}
+
+	cfClient = newSessionClient(token)
+	cfAccount, err = getAccount(ctx)
+	return err
+}
+
+func revokeToken(ctx context.Context, token *oauth2.Token) error {
+	value := token.RefreshToken
+	if value == "" {
+		value = token.AccessToken
+	}
+
+	form := url.Values{
+		"client_id": {config.ClientID},
+		"token":     {value},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revokeURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error revoking token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error revoking token: %s", resp.Status)
+	}
+
+	return nil
+}
+
+func logout(ctx context.Context) error {
+	token, err := loadToken()
+	if errors.Is(err, errNoSession) {
+		fmt.Printf("%s 当前没有保存的会话。\n", info)
+		return nil
+	}
+
+	if err == nil {
+		if err := revokeToken(ctx, token); err != nil {
+			failMessage("吊销令牌失败，将仅删除本地会话。")
+			log.Printf("%v\n", err)
+		}
+	}
+
+	if err := deleteToken(); err != nil {
+		return err
+	}
+
+	successMessage("已退出登录。")
+	return nil
+}
+
+func whoami(ctx context.Context) error {
+	if apiToken == "" {
+		if _, err := loadToken(); err != nil {
+			return fmt.Errorf("not logged in, run \"BPB-Wizard login\" first: %w", err)
+		}
+	}
+
+	if err := ensureLogin(ctx); err != nil {
+		return err
+	}
+
+	res, err := cfClient.User.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	var email, userID string
+	if details, ok := (*res).(map[string]any); ok {
+		email, _ = details["email"].(string)
+		userID, _ = details["id"].(string)
+	}
+
+	fmt.Printf("\n%s 用户: %s (%s)\n", info, fmtStr(email, GREEN, true), userID)
+	fmt.Printf("%s 账号: %s (%s)\n", info, fmtStr(cfAccount.Name, ORANGE, true), cfAccount.ID)
+	emitResult(map[string]any{
+		"email":        email,
+		"user_id":      userID,
+		"account_id":   cfAccount.ID,
+		"account_name": cfAccount.Name,
+	})
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// localVersion labels a worker.js given with --worker-file when no release
+// version was specified.
+const localVersion = "local"
+
+var (
+	workerFile    string
+	workerMirrors []string
+	mirrorTimeout = 60 * time.Second
+)
+
+// workerSource is one place worker.js can be downloaded from.
+type workerSource struct {
+	Name string
+	URL  string
+}
+
+// addSourceFlags registers the flags choosing where worker.js comes from.
+func addSourceFlags(fs *flag.FlagSet) {
+	fs.StringVar(&workerFile, "worker-file", workerFile, "Deploy a local worker.js instead of downloading a release")
+	fs.Func("mirror", "Mirror URL tried before GitHub, repeatable or comma separated; {url} and {tag} are replaced, otherwise the GitHub URL is appended (env BPB_WORKER_MIRRORS)", func(value string) error {
+		workerMirrors = append(workerMirrors, splitList(value)...)
+		return nil
+	})
+	fs.DurationVar(&mirrorTimeout, "mirror-timeout", mirrorTimeout, "Give up on a mirror or GitHub after receiving no data for this long")
+	fs.BoolVar(&offline, "offline", offline, "Do not download anything, deploy the worker.js bundled in this build or a cached one")
+}
+
+// mirrorList returns the mirrors from --mirror, BPB_WORKER_MIRRORS or
+// worker_mirrors in config.json, the first one set wins.
+func mirrorList() []string {
+	if len(workerMirrors) > 0 {
+		return workerMirrors
+	}
+
+	if value := os.Getenv("BPB_WORKER_MIRRORS"); value != "" {
+		return splitList(value)
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+
+	return cfg.WorkerMirrors
+}
+
+// mirrorURL builds the download URL of a mirror for the given GitHub URL.
+func mirrorURL(mirror, githubURL, tag string) string {
+	if !strings.Contains(mirror, "{url}") && !strings.Contains(mirror, "{tag}") {
+		return strings.TrimSuffix(mirror, "/") + "/" + githubURL
+	}
+
+	return strings.NewReplacer("{url}", githubURL, "{tag}", tag).Replace(mirror)
+}
+
+// workerSources lists where to download the worker.js of release from, in
+// order: the configured mirrors, then GitHub.
+func workerSources(release *Release) []workerSource {
+	githubURL := release.workerURL()
+	var sources []workerSource
+	for _, mirror := range mirrorList() {
+		sources = append(sources, workerSource{Name: "mirror", URL: mirrorURL(mirror, githubURL, release.TagName)})
+	}
+
+	return append(sources, workerSource{Name: "github", URL: githubURL})
+}
+
+// localRelease describes the --worker-file build. It keeps the version of
+// --worker-version so the file can still be checked against that release.
+func localRelease() *Release {
+	tag := workerVersion
+	if tag == "" {
+		tag = localVersion
+	}
+
+	return &Release{TagName: tag}
+}
+
+func useLocalWorker(release *Release) error {
+	if err := copyFile(workerFile, workerPath); err != nil {
+		return fmt.Errorf("error reading --worker-file: %w", err)
+	}
+
+	release.source = "file:" + workerFile
+	downloadedVersion = ""
+	successMessage(fmt.Sprintf("使用本地文件 %s。", fmtStr(workerFile, ORANGE, true)))
+	emitStep("download", StatusSkipped, map[string]any{"source": release.source, "version": release.TagName})
+	return nil
+}
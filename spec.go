@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// PanelSpec describes a panel deployment. It is read from a YAML file, and
+// since JSON is valid YAML the same loader accepts JSON specs too.
+type PanelSpec struct {
+	Type          string   `yaml:"type"`
+	Name          string   `yaml:"name"`
+	UUID          string   `yaml:"uuid"`
+	TrojanPass    string   `yaml:"trojan_pass"`
+	ProxyIPs      []string `yaml:"proxy_ips"`
+	Fallback      string   `yaml:"fallback"`
+	SubPath       string   `yaml:"sub_path"`
+	CustomDomains []string `yaml:"custom_domains"`
+	KVName        string   `yaml:"kv_name"`
+}
+
+func loadPanelSpec(path string) (*PanelSpec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading spec file: %w", err)
+	}
+
+	var spec PanelSpec
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("error parsing spec file %s: %w", path, err)
+	}
+
+	return &spec, nil
+}
+
+func (spec *PanelSpec) options() CreateOptions {
+	return CreateOptions{
+		Type:          spec.Type,
+		Name:          spec.Name,
+		UUID:          spec.UUID,
+		TrojanPass:    spec.TrojanPass,
+		ProxyIP:       strings.Join(spec.ProxyIPs, ","),
+		Fallback:      spec.Fallback,
+		SubPath:       spec.SubPath,
+		CustomDomains: spec.CustomDomains,
+		KVName:        spec.KVName,
+	}
+}
+
+// mergeOptions returns base with every field that is set in override replacing
+// the base value, so command line flags take precedence over the spec file.
+func mergeOptions(base, override CreateOptions) CreateOptions {
+	if override.Type != "" {
+		base.Type = override.Type
+	}
+	if override.Name != "" {
+		base.Name = override.Name
+	}
+	if override.UUID != "" {
+		base.UUID = override.UUID
+	}
+	if override.TrojanPass != "" {
+		base.TrojanPass = override.TrojanPass
+	}
+	if override.ProxyIP != "" {
+		base.ProxyIP = override.ProxyIP
+	}
+	if override.Fallback != "" {
+		base.Fallback = override.Fallback
+	}
+	if override.SubPath != "" {
+		base.SubPath = override.SubPath
+	}
+	if len(override.CustomDomains) > 0 {
+		base.CustomDomains = override.CustomDomains
+	}
+	if override.KVName != "" {
+		base.KVName = override.KVName
+	}
+
+	return base
+}
+
+type fieldError struct {
+	Field string
+	Err   error
+}
+
+func (fe fieldError) Error() string {
+	return fmt.Sprintf("%s: %s", fe.Field, strings.TrimSpace(fe.Err.Error()))
+}
+
+// validateCreateOptions checks every preset value with the same rules the
+// interactive prompts use and reports all invalid fields at once.
+func validateCreateOptions(opts CreateOptions) []fieldError {
+	var errs []fieldError
+	addError := func(field string, err error) {
+		errs = append(errs, fieldError{Field: field, Err: err})
+	}
+
+	if opts.Type != "" {
+		if _, err := parseDeployType(opts.Type); err != nil {
+			addError("type", err)
+		}
+	}
+
+	if opts.Name != "" {
+		if err := isValidSubDomain(opts.Name); err != nil {
+			addError("name", err)
+		}
+	}
+
+	if opts.UUID != "" {
+		if _, err := uuid.Parse(opts.UUID); err != nil {
+			addError("uuid", err)
+		}
+	}
+
+	if opts.TrojanPass != "" && !isValidTrPassword(opts.TrojanPass) {
+		addError("trojan_pass", errors.New("contains non-standard characters"))
+	}
+
+	if opts.ProxyIP != "" {
+		if err := validateProxyIPs(opts.ProxyIP); err != nil {
+			addError("proxy_ips", err)
+		}
+	}
+
+	if opts.Fallback != "" && !isValidIpDomain(opts.Fallback) && !isValidHost(opts.Fallback) {
+		addError("fallback", fmt.Errorf("%q is not a valid IP or domain", opts.Fallback))
+	}
+
+	if opts.SubPath != "" && !isValidSubURIPath(opts.SubPath) {
+		addError("sub_path", errors.New("contains non-standard characters"))
+	}
+
+	if err := validateCustomDomains(opts.CustomDomains); err != nil {
+		addError("custom_domains", err)
+	}
+
+	if len(opts.KVName) > 512 {
+		addError("kv_name", errors.New("must be at most 512 characters"))
+	}
+
+	return errs
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestMergeOptions(t *testing.T) {
+	base := CreateOptions{
+		Type:          "pages",
+		Name:          "spec-name",
+		UUID:          "spec-uuid",
+		ProxyIP:       "1.1.1.1",
+		CustomDomains: []string{"spec.example.com"},
+		KVName:        "spec-kv",
+	}
+
+	tests := []struct {
+		name     string
+		override CreateOptions
+		want     CreateOptions
+	}{
+		{"empty override keeps base", CreateOptions{}, base},
+		{
+			"set fields replace base",
+			CreateOptions{Name: "flag-name", TrojanPass: "flag-pass", CustomDomains: []string{"flag.example.com"}},
+			CreateOptions{
+				Type:          "pages",
+				Name:          "flag-name",
+				UUID:          "spec-uuid",
+				TrojanPass:    "flag-pass",
+				ProxyIP:       "1.1.1.1",
+				CustomDomains: []string{"flag.example.com"},
+				KVName:        "spec-kv",
+			},
+		},
+		{
+			"empty domain list keeps base domains",
+			CreateOptions{Type: "worker", CustomDomains: []string{}},
+			CreateOptions{
+				Type:          "worker",
+				Name:          "spec-name",
+				UUID:          "spec-uuid",
+				ProxyIP:       "1.1.1.1",
+				CustomDomains: []string{"spec.example.com"},
+				KVName:        "spec-kv",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := mergeOptions(base, tt.override); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: mergeOptions() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCreateOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CreateOptions
+		want []string
+	}{
+		{"empty options", CreateOptions{}, nil},
+		{
+			"valid options",
+			CreateOptions{
+				Type:          "pages",
+				Name:          "my-panel",
+				UUID:          "0b5a2e6c-2f7b-4f59-9d43-3c1b4f0f3c11",
+				TrojanPass:    "Secret123",
+				ProxyIP:       "1.1.1.1, proxy.example.com",
+				Fallback:      "speed.cloudflare.com",
+				SubPath:       "abc123",
+				CustomDomains: []string{"panel.example.com"},
+				KVName:        "panel-kv",
+			},
+			nil,
+		},
+		{"invalid type", CreateOptions{Type: "lambda"}, []string{"type"}},
+		{"name with bpb", CreateOptions{Name: "my-bpb-panel"}, []string{"name"}},
+		{"name starting with a dash", CreateOptions{Name: "-panel"}, []string{"name"}},
+		{
+			"every field invalid",
+			CreateOptions{
+				Type:          "lambda",
+				Name:          "bad_name",
+				UUID:          "not-a-uuid",
+				TrojanPass:    "pass word",
+				ProxyIP:       "1.1.1.1,not a host",
+				Fallback:      "not a host",
+				SubPath:       "sub/path",
+				CustomDomains: []string{"example"},
+				KVName:        string(make([]byte, 513)),
+			},
+			[]string{"type", "name", "uuid", "trojan_pass", "proxy_ips", "fallback", "sub_path", "custom_domains", "kv_name"},
+		},
+	}
+
+	for _, tt := range tests {
+		var got []string
+		for _, fe := range validateCreateOptions(tt.opts) {
+			got = append(got, fe.Field)
+		}
+
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: validateCreateOptions() fields = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Script size limits of Workers, which also apply to Pages Functions
+// (_worker.js). Cloudflare measures the gzip compressed size.
+const (
+	workersFreeLimit   = 3 << 20
+	workersPaidLimit   = 10 << 20
+	workersUnzipLimit  = 64 << 20
+	pagesFileSizeLimit = 25 << 20
+)
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+var defaultExportRegex = regexp.MustCompile(`\bexport\s+default\b|\bexport\s*\{[^}]*\bas\s+default\b`)
+
+// scriptCheck is one line of the pre-upload validation report.
+type scriptCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	label  string
+}
+
+// checkWorkerScript runs the pre-upload checks on a worker.js.
+func checkWorkerScript(script []byte) []scriptCheck {
+	if len(bytes.TrimSpace(script)) == 0 {
+		return []scriptCheck{{Name: "content", label: "内容", Status: checkFail, Detail: "文件为空"}}
+	}
+
+	checks := []scriptCheck{checkScriptSize(script), checkScriptContent(script)}
+	if checks[1].Status == checkFail {
+		return checks
+	}
+
+	export := scriptCheck{Name: "default_export", label: "默认导出", Status: checkPass, Detail: "找到 export default 处理程序"}
+	if !defaultExportRegex.Match(script) {
+		export.Status, export.Detail = checkFail, "未找到 export default，不是有效的 Workers 模块"
+	}
+
+	return append(checks, export)
+}
+
+func checkScriptSize(script []byte) scriptCheck {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	writer.Write(script)
+	writer.Close()
+
+	size, gzipSize := len(script), compressed.Len()
+	check := scriptCheck{
+		Name:   "size",
+		label:  "大小",
+		Status: checkPass,
+		Detail: fmt.Sprintf("%s（gzip 后 %s）", formatBytes(int64(size)), formatBytes(int64(gzipSize))),
+	}
+
+	switch {
+	case size > workersUnzipLimit || size > pagesFileSizeLimit || gzipSize > workersPaidLimit:
+		check.Status = checkFail
+		check.Detail += "，超过 Workers 和 Pages 的脚本大小上限"
+	case gzipSize > workersFreeLimit:
+		check.Status = checkWarn
+		check.Detail += "，超过 Workers 免费版 3 MB 上限，需要付费版"
+	}
+
+	return check
+}
+
+// checkScriptContent catches downloads that are not JavaScript at all, like
+// an HTML error page or a GitHub API rate limit response.
+func checkScriptContent(script []byte) scriptCheck {
+	head := strings.ToLower(string(bytes.TrimSpace(script[:min(len(script), 1024)])))
+	check := scriptCheck{Name: "content", label: "内容", Status: checkPass, Detail: "JavaScript"}
+
+	// JavaScript never starts with "<", HTML and XML pages always do.
+	switch {
+	case strings.HasPrefix(head, "<"):
+		check.Status, check.Detail = checkFail, "下载到的是 HTML/XML 页面（可能是错误页或限流页面）"
+	case strings.HasPrefix(head, "{") && strings.Contains(head, `"message"`):
+		check.Status, check.Detail = checkFail, "下载到的是 JSON 错误响应"
+	case len(script) < 200 && !defaultExportRegex.Match(script) && (strings.Contains(head, "not found") || strings.Contains(head, "rate limit")):
+		check.Status, check.Detail = checkFail, fmt.Sprintf("下载到的是错误信息: %q", head)
+	}
+
+	return check
+}
+
+// validateWorker checks worker.js before upload and prints a pass/fail
+// report. Warnings are reported but do not stop the deployment.
+func validateWorker() error {
+	fmt.Printf("\n%s 检查 %s...\n", title, fmtStr("worker.js", GREEN, true))
+	emitStep("validate", StatusStarted, nil)
+
+	script, err := os.ReadFile(workerPath)
+	if err != nil {
+		emitStepError("validate", err)
+		return fmt.Errorf("error reading worker.js: %w", err)
+	}
+
+	checks := checkWorkerScript(script)
+	var failed []string
+	for _, check := range checks {
+		mark := fmtStr("✓", GREEN, true)
+		switch check.Status {
+		case checkWarn:
+			mark = fmtStr("!", ORANGE, true)
+		case checkFail:
+			mark = fmtStr("✗", RED, true)
+			failed = append(failed, check.Name)
+		}
+
+		fmt.Printf(" %s %s: %s\n", mark, check.label, check.Detail)
+	}
+
+	if len(failed) > 0 {
+		err := errors.New("worker.js failed validation: " + strings.Join(failed, ", "))
+		writeEvent(Event{Event: "step", Step: "validate", Status: StatusFailed, Error: err.Error(), Data: map[string]any{"checks": checks}})
+		return err
+	}
+
+	successMessage("worker.js 检查通过。")
+	emitStep("validate", StatusSucceeded, map[string]any{"checks": checks})
+	return nil
+}
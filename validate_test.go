@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckScriptContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"module", "export default { async fetch(request) { return new Response('ok'); } };", checkPass},
+		{"leading whitespace", "\n\n  export default {};", checkPass},
+		{"html page", "<!DOCTYPE html><html><body>Error</body></html>", checkFail},
+		{"html after whitespace", "  \n<HTML>", checkFail},
+		{"github api error", `{"message": "API rate limit exceeded"}`, checkFail},
+		{"plain not found", "404: Not Found", checkFail},
+		{"plain rate limit", "Rate limit exceeded, retry later", checkFail},
+		{"short module mentioning not found", "export default { fetch() { return 'not found'; } };", checkPass},
+		{"long script mentioning not found", "// not found\n" + strings.Repeat("const a = 1;\n", 20), checkPass},
+	}
+
+	for _, tt := range tests {
+		if got := checkScriptContent([]byte(tt.script)); got.Status != tt.want {
+			t.Errorf("%s: checkScriptContent() = %s (%s), want %s", tt.name, got.Status, got.Detail, tt.want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	checksumAsset  = workerAsset + ".sha256"
+	signatureAsset = workerAsset + ".sig"
+)
+
+var errAssetNotFound = errors.New("release asset not found")
+
+var (
+	workerSHA256    string
+	allowUnverified bool
+)
+
+// WorkerDigest describes the worker.js about to be deployed and how its
+// integrity was established.
+type WorkerDigest struct {
+	SHA256 string
+	Source string
+	Signed bool
+}
+
+func (d *WorkerDigest) verified() bool {
+	return d.Source != "" || d.Signed
+}
+
+// addVerifyFlags registers the flags controlling worker.js verification.
+func addVerifyFlags(fs *flag.FlagSet) {
+	fs.StringVar(&workerSHA256, "worker-sha256", workerSHA256, "Expected SHA-256 of worker.js, overrides the hash published with the release")
+	fs.BoolVar(&allowUnverified, "allow-unverified", allowUnverified, "Deploy worker.js even when no hash or signature is available to verify it")
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// assetURL returns the download address of a release asset. Without release
+// metadata (the API was unreachable) the address is derived from the tag.
+func (r *Release) assetURL(name string) (string, error) {
+	if r.Assets == nil {
+		return strings.TrimSuffix(workerDownloadURL(r.TagName), workerAsset) + name, nil
+	}
+
+	asset, err := r.asset(name)
+	if err != nil {
+		return "", errAssetNotFound
+	}
+
+	return asset.DownloadURL, nil
+}
+
+// fetchAsset downloads a small release asset such as a checksum or signature.
+func fetchAsset(ctx context.Context, release *Release, name string) ([]byte, error) {
+	url, err := release.assetURL(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errAssetNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error downloading %s: %s", name, resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
+
+// parseSHA256 accepts a bare hex hash, "sha256:<hex>" or a sha256sum line.
+func parseSHA256(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("empty sha256")
+	}
+
+	hash := strings.ToLower(strings.TrimPrefix(fields[0], "sha256:"))
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 %q", fields[0])
+	}
+
+	return hash, nil
+}
+
+// expectedWorkerHash returns the SHA-256 worker.js must have and where it
+// comes from: --worker-sha256, a hash pinned in config.json, the digest
+// GitHub publishes for the asset or a worker.js.sha256 release asset.
+func expectedWorkerHash(ctx context.Context, release *Release, cfg *WizardConfig) (string, string, error) {
+	if workerSHA256 != "" {
+		hash, err := parseSHA256(workerSHA256)
+		return hash, "--worker-sha256", err
+	}
+
+	if pinned, ok := cfg.WorkerHashes[release.TagName]; ok {
+		hash, err := parseSHA256(pinned)
+		return hash, "config.json", err
+	}
+
+	if release.source == bundledSource {
+		return bundleSHA256(), "bundle", nil
+	}
+
+	if offline || release.TagName == localVersion {
+		return "", "", nil
+	}
+
+	if asset, err := release.asset(workerAsset); err == nil && strings.HasPrefix(asset.Digest, "sha256:") {
+		hash, err := parseSHA256(asset.Digest)
+		return hash, "GitHub digest", err
+	}
+
+	data, err := fetchAsset(ctx, release, checksumAsset)
+	if err != nil {
+		if !errors.Is(err, errAssetNotFound) {
+			log.Printf("%v\n", err)
+		}
+
+		return "", "", nil
+	}
+
+	hash, err := parseSHA256(string(data))
+	return hash, checksumAsset, err
+}
+
+// verifyWorkerSignature checks worker.js against the release's ed25519
+// signature, raw or base64 encoded, using the public key from config.json.
+func verifyWorkerSignature(ctx context.Context, release *Release, publicKey string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid worker_public_key in config, expected a base64 ed25519 public key")
+	}
+
+	signature, err := fetchAsset(ctx, release, signatureAsset)
+	if err != nil {
+		return fmt.Errorf("error getting %s: %w", signatureAsset, err)
+	}
+
+	if len(signature) != ed25519.SignatureSize {
+		signature, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", signatureAsset, err)
+		}
+	}
+
+	script, err := os.ReadFile(workerPath)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(key, script, signature) {
+		return fmt.Errorf("worker.js signature does not match the configured public key")
+	}
+
+	return nil
+}
+
+// verifyWorker checks the downloaded worker.js before it is deployed. A hash
+// or signature mismatch is always fatal and the file is removed; a file that
+// cannot be verified at all is only deployed after confirmation or with
+// --allow-unverified.
+func verifyWorker(ctx context.Context, release *Release) (*WorkerDigest, error) {
+	fmt.Printf("\n%s 校验 %s...\n", title, fmtStr("worker.js", GREEN, true))
+	emitStep("verify", StatusStarted, nil)
+
+	digest, err := checkWorker(ctx, release)
+	if err != nil {
+		if digest != nil {
+			os.Remove(workerPath)
+			downloadedVersion = ""
+		}
+
+		emitStepError("verify", err)
+		return nil, err
+	}
+
+	fmt.Printf("%s SHA-256: %s\n", info, fmtStr(digest.SHA256, ORANGE, false))
+	data := map[string]any{"sha256": digest.SHA256, "source": digest.Source, "signed": digest.Signed}
+	if digest.verified() {
+		successMessage(fmt.Sprintf("worker.js 校验通过（%s）。", digest.describe()))
+		emitStep("verify", StatusSucceeded, data)
+		return digest, nil
+	}
+
+	fmt.Printf("%s 该版本没有发布校验值或签名，无法验证 worker.js 的完整性。\n", warning)
+	if !allowUnverified && !confirmStrict("是否仍然部署？(y/n): ", false) {
+		err := fmt.Errorf("worker.js could not be verified, pass --worker-sha256 or --allow-unverified")
+		emitStepError("verify", err)
+		return nil, err
+	}
+
+	emitStep("verify", StatusSkipped, data)
+	return digest, nil
+}
+
+// checkWorker hashes worker.js and compares it with the expected hash and
+// signature. The returned digest is nil when the checks could not run.
+func checkWorker(ctx context.Context, release *Release) (*WorkerDigest, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	actual, err := fileSHA256(workerPath)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing worker.js: %w", err)
+	}
+
+	digest := &WorkerDigest{SHA256: actual}
+	expected, source, err := expectedWorkerHash(ctx, release, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if expected != "" {
+		if actual != expected {
+			failMessage(fmt.Sprintf("worker.js 校验失败！期望 %s，实际 %s", fmtStr(expected, GREEN, false), fmtStr(actual, RED, false)))
+			return digest, fmt.Errorf("worker.js sha256 mismatch: expected %s (%s), got %s", expected, source, actual)
+		}
+
+		digest.Source = source
+	}
+
+	if cfg.WorkerPublicKey != "" {
+		if err := verifyWorkerSignature(ctx, release, cfg.WorkerPublicKey); err != nil {
+			failMessage("worker.js 签名校验失败！")
+			return digest, err
+		}
+
+		digest.Signed = true
+	}
+
+	return digest, nil
+}
+
+func (d *WorkerDigest) describe() string {
+	var parts []string
+	if d.Source != "" {
+		parts = append(parts, "SHA-256 来自 "+d.Source)
+	}
+	if d.Signed {
+		parts = append(parts, "ed25519 签名")
+	}
+
+	return strings.Join(parts, "，")
+}
+
+// status describes the verification outcome for summaries.
+func (d *WorkerDigest) status() string {
+	if !d.verified() {
+		return fmtStr("未校验", RED, true)
+	}
+
+	return fmtStr("匹配", GREEN, true) + "，" + d.describe()
+}
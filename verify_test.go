@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestParseSHA256(t *testing.T) {
+	const hash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{hash, hash, false},
+		{"E3B0C44298FC1C149AFBF4C8996FB92427AE41E4649B934CA495991B7852B855", hash, false},
+		{"sha256:" + hash, hash, false},
+		{hash + "  worker.js\n", hash, false},
+		{"", "", true},
+		{"   ", "", true},
+		{hash[:63], "", true},
+		{hash[:62] + "zz", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseSHA256(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseSHA256(%q) = %q, %v, want %q, error %t", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
+	"math/big"
 	"net"
 	"net/http"
 	"os"
@@ -38,6 +39,17 @@ func (dt DeployType) String() string {
 	return DeployTypeNames[dt]
 }
 
+func parseDeployType(value string) (DeployType, error) {
+	switch strings.ToLower(value) {
+	case "worker", "workers":
+		return DTWorker, nil
+	case "page", "pages":
+		return DTPage, nil
+	default:
+		return DTWorker, fmt.Errorf("invalid deploy type %q, expected worker or pages", value)
+	}
+}
+
 type Panel struct {
 	Name string
 	Type string
@@ -52,64 +64,151 @@ const (
 	DomainRegex              = `^(?i)([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,}$`
 )
 
-func downloadFile(url, dest string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
+// downloadedVersion is the release tag of the worker.js at workerPath.
+var downloadedVersion string
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("error downloading worker.js: %s", resp.Status)
-	}
+func downloadWorker(release *Release) error {
+	fmt.Printf("\n%s Downloading %s %s...\n", title, fmtStr("worker.js", GREEN, true), fmtStr(release.TagName, ORANGE, true))
+	emitStep("download", StatusStarted, map[string]any{"version": release.TagName})
 
-	out, err := os.Create(dest)
-	if err != nil {
-		return err
+	if workerFile != "" {
+		return useLocalWorker(release)
 	}
-	defer out.Close()
 
-	if _, err = io.Copy(out, resp.Body); err != nil {
-		return err
-	}
+	if offline {
+		if cached := findCachedWorker(release.TagName, ""); cached != nil && release.source != bundledSource {
+			return useCachedWorker(release, cached)
+		}
 
-	return nil
-}
+		if hasBundle() {
+			return useBundledWorker(release)
+		}
 
-func downloadWorker() error {
-	fmt.Printf("\n%s Downloading %s...\n", title, fmtStr("worker.js", GREEN, true))
+		return fmt.Errorf("no bundled or cached worker.js %s available offline", release.TagName)
+	}
 
 	for {
 		if _, err := os.Stat(workerPath); err != nil {
 			if !os.IsNotExist(err) {
 				return fmt.Errorf("failed to check worker.js: %w", err)
 			}
-		} else {
+		} else if downloadedVersion == release.TagName {
 			successMessage("worker.js already exists, skipping download.")
+			emitStep("download", StatusSkipped, map[string]any{"source": release.source})
 			return nil
 		}
 
-		if err := downloadFile(workerURL, workerPath); err != nil {
+		if cached := cachedRelease(release); cached != nil {
+			return useCachedWorker(release, cached)
+		}
+
+		var err error
+		for _, source := range workerSources(release) {
+			fmt.Printf("%s 从 %s 下载: %s\n", info, fmtStr(source.Name, GREEN, true), source.URL)
+			if err = downloadFile(source.URL, workerPath, mirrorTimeout); err != nil {
+				failMessage(fmt.Sprintf("从 %s 下载失败：%s。", source.URL, downloadErrorMessage(err)))
+				log.Printf("%v\n", err)
+				continue
+			}
+
+			release.source = source.Name + ":" + source.URL
+			break
+		}
+
+		if err != nil {
 			failMessage("Failed to download worker.js")
-			log.Printf("%v\n", err)
-			if response := promptUser("Would you like to try again? (y/n): "); strings.ToLower(response) == "n" {
-				os.Exit(0)
+			emitStepError("download", err)
+			if cached := findCachedWorker(release.TagName, ""); cached != nil {
+				fmt.Printf("%s 无法下载，改用缓存中的 %s 版本。\n", info, fmtStr(cached.Version, ORANGE, true))
+				return useCachedWorker(release, cached)
+			}
+
+			if hasBundle() {
+				fmt.Printf("%s 无法下载，改用内置的 %s 版本。\n", info, fmtStr(bundleVersion(), ORANGE, true))
+				return useBundledWorker(release)
+			}
+
+			if !confirm("Would you like to try again? (y/n): ", false) {
+				return err
 			}
 			continue
 		}
 
+		downloadedVersion = release.TagName
 		successMessage("worker.js downloaded successfully!")
+		emitStep("download", StatusSucceeded, map[string]any{"source": release.source})
 		return nil
 	}
 }
 
+// cachedRelease returns the cached build of release when it can be reused
+// without downloading: either its published digest matches, or the release
+// is a fixed tag (the "latest" alias is always downloaded).
+func cachedRelease(release *Release) *CachedWorker {
+	if asset, err := release.asset(workerAsset); err == nil && strings.HasPrefix(asset.Digest, "sha256:") {
+		return findCachedWorker(release.TagName, strings.TrimPrefix(asset.Digest, "sha256:"))
+	}
+
+	if release.TagName == latestVersion {
+		return nil
+	}
+
+	return findCachedWorker(release.TagName, "")
+}
+
+func useCachedWorker(release *Release, cached *CachedWorker) error {
+	if err := copyFile(cached.Path, workerPath); err != nil {
+		return fmt.Errorf("error copying cached worker.js: %w", err)
+	}
+
+	// The "latest" alias resolves to whatever release the cache holds.
+	release.TagName = cached.Version
+	release.source = "cache:" + cached.Path
+	downloadedVersion = release.TagName
+	successMessage(fmt.Sprintf("使用缓存的 worker.js（%s）。", cached.Version))
+	emitStep("download", StatusSkipped, map[string]any{"source": release.source, "version": cached.Version, "sha256": cached.SHA256})
+	return nil
+}
+
+// prepareWorker gets the worker.js of release, checks and verifies it and
+// keeps it in the cache for later runs.
+func prepareWorker(ctx context.Context, release *Release) (*WorkerDigest, error) {
+	if err := downloadWorker(release); err != nil {
+		return nil, err
+	}
+
+	if err := validateWorker(); err != nil {
+		os.Remove(workerPath)
+		downloadedVersion = ""
+		return nil, err
+	}
+
+	digest, err := verifyWorker(ctx, release)
+	if err != nil {
+		return nil, err
+	}
+
+	preparedVersion = releaseVersion(release)
+	fmt.Printf("%s worker.js 来源: %s，哈希校验: %s\n", info, fmtStr(release.source, GREEN, false), digest.status())
+	if workerFile == "" && release.TagName != latestVersion && digest.verified() {
+		if err := storeWorker(release.TagName, digest.SHA256); err != nil {
+			log.Printf("%v\n", err)
+		}
+	}
+
+	return digest, nil
+}
+
 func generateRandomString(charSet string, length int, isDomain bool) string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	limit := big.NewInt(int64(len(charSet)))
 	randomBytes := make([]byte, length)
 
 	for i := range randomBytes {
 		for {
-			char := charSet[r.Intn(len(charSet))]
+			// crypto/rand.Int only fails when the reader does, and crypto/rand.Reader
+			// aborts the program instead of returning an error.
+			n, _ := rand.Int(rand.Reader, limit)
+			char := charSet[n.Int64()]
 			if isDomain && (i == 0 || i == length-1) && char == byte('-') {
 				continue
 			}
@@ -121,8 +220,13 @@ func generateRandomString(charSet string, length int, isDomain bool) string {
 	return string(randomBytes)
 }
 
-func generateRandomSubDomain(subDomainLength int) string {
-	return generateRandomString(CharsetSubDomain, subDomainLength, true)
+func generateRandomSubDomain(policy SecretPolicy) string {
+	for {
+		subDomain := generateRandomString(policy.alphabet(), policy.Length, true)
+		if isValidSubDomain(subDomain) == nil {
+			return subDomain
+		}
+	}
 }
 
 func isValidSubDomain(subDomain string) error {
@@ -168,8 +272,8 @@ func isValidHost(value string) bool {
 	return true
 }
 
-func generateTrPassword(passwordLength int) string {
-	return generateRandomString(CharsetTrojanPassword, passwordLength, false)
+func generateTrPassword(policy SecretPolicy) string {
+	return generateRandomString(policy.alphabet(), policy.Length, false)
 }
 
 func isValidTrPassword(trojanPassword string) bool {
@@ -182,8 +286,8 @@ func isValidTrPassword(trojanPassword string) bool {
 	return true
 }
 
-func generateSubURIPath(uriLength int) string {
-	return generateRandomString(CharsetURIPath, uriLength, false)
+func generateSubURIPath(policy SecretPolicy) string {
+	return generateRandomString(policy.alphabet(), policy.Length, false)
 }
 
 func isValidSubURIPath(uri string) bool {
@@ -196,21 +300,47 @@ func isValidSubURIPath(uri string) bool {
 	return true
 }
 
+var stdinReader = bufio.NewReader(os.Stdin)
+
 func promptUser(prompt string) string {
 	fmt.Printf("%s %s", ask, prompt)
-	reader := bufio.NewReader(os.Stdin)
-	input, err := reader.ReadString('\n')
+	input, err := stdinReader.ReadString('\n')
 	if err != nil {
 		fmt.Printf("\n%s Exiting...\n", title)
 		if err == io.EOF {
-			os.Exit(0)
+			exit(0)
 		}
-		os.Exit(1)
+		exit(1)
 	}
 
 	return strings.TrimSpace(input)
 }
 
+// confirm asks a yes/no question. With --yes no prompt is shown and def is
+// returned, so retry loops stop and destructive confirmations go ahead.
+func confirm(prompt string, def bool) bool {
+	if assumeYes {
+		return def
+	}
+
+	return strings.ToLower(promptUser(prompt)) != "n"
+}
+
+// confirmStrict is confirm for destructive or security-relevant questions:
+// only an explicit "y" or "yes" agrees. With --yes def is returned.
+func confirmStrict(prompt string, def bool) bool {
+	if assumeYes {
+		return def
+	}
+
+	switch strings.ToLower(strings.TrimSpace(promptUser(prompt))) {
+	case "y", "yes":
+		return true
+	default:
+		return false
+	}
+}
+
 func failMessage(message string) {
 	errMark := fmtStr("✗", RED, true)
 	fmt.Printf("%s %s\n", errMark, message)
@@ -252,18 +382,7 @@ func checkBPBPanel(url string) error {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	dialer := &net.Dialer{
-		Resolver: &net.Resolver{
-			PreferGo: true,
-			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				d := net.Dialer{
-					Timeout: time.Duration(5000) * time.Millisecond,
-				}
-
-				return d.DialContext(ctx, "udp", "8.8.8.8:53")
-			},
-		},
-	}
+	dialer := &net.Dialer{Resolver: publicResolver}
 
 	dialContext := func(ctx context.Context, network, addr string) (net.Conn, error) {
 		conn, err := dialer.DialContext(ctx, network, addr)
@@ -283,7 +402,16 @@ func checkBPBPanel(url string) error {
 		Timeout:   15 * time.Second,
 	}
 
-	for range ticker.C {
+	deadline := time.After(panelTimeout)
+	emitStep("health_check", StatusStarted, map[string]any{"url": url})
+	for {
+		select {
+		case <-deadline:
+			fmt.Println()
+			return fmt.Errorf("BPB panel at %s did not respond within %s", url, panelTimeout)
+		case <-ticker.C:
+		}
+
 		resp, err := client.Get(url)
 		if err != nil {
 			fmt.Printf(".")
@@ -299,10 +427,11 @@ func checkBPBPanel(url string) error {
 		resp.Body.Close()
 		message := fmt.Sprintf("BPB panel is ready -> %s", url)
 		successMessage(message)
+		emitStep("health_check", StatusSucceeded, map[string]any{"url": url})
 		fmt.Print("\n")
 		prompt := fmt.Sprintf("Would you like to open %s in browser? (y/n): ", fmtStr("BPB panel", BLUE, true))
 
-		if response := promptUser(prompt); strings.ToLower(response) == "n" {
+		if !confirm(prompt, false) {
 			return nil
 		}
 
@@ -312,8 +441,6 @@ func checkBPBPanel(url string) error {
 
 		return nil
 	}
-
-	return nil
 }
 
 func runWizard() {
@@ -323,15 +450,18 @@ func runWizard() {
 	fmt.Printf("%s 请确保你拥有已验证的 %s 账号。\n\n", info, fmtStr("Cloudflare", ORANGE, true))
 
 	for {
-		message := fmt.Sprintf("请输入 1 以%s新面板，或 2 以%s已有面板: ", fmtStr("创建", GREEN, true), fmtStr("修改", RED, true))
+		message := fmt.Sprintf("请输入 1 以%s新面板，2 以%s已有面板，或 3 以%s: ", fmtStr("创建", GREEN, true), fmtStr("修改", RED, true), fmtStr("切换账号", BLUE, true))
 		response := promptUser(message)
 		switch response {
 		case "1":
 			createPanel()
 		case "2":
 			modifyPanel()
+		case "3":
+			switchAccount()
+			continue
 		default:
-			failMessage("选择错误，请只输入 1 或 2！\n")
+			failMessage("选择错误，请只输入 1、2 或 3！\n")
 			continue
 		}
 
@@ -343,52 +473,53 @@ func runWizard() {
 	}
 }
 
-func createPanel() {
-	ctx := context.Background()
-	var err error
-	if cfClient == nil || cfAccount == nil {
-		go login()
-		token := <-obtainedToken
-		cfClient = NewClient(token)
+func getDeployType() DeployType {
+	fmt.Printf("\n%s 你可以选择使用 %s 或 %s 进行部署。\n", info, fmtStr("Workers", ORANGE, true), fmtStr("Pages", ORANGE, true))
+	fmt.Printf("%s %s: 如果选择 %s，访问面板可能需要最多 5 分钟，请耐心等待！\n", info, warning, fmtStr("Pages", ORANGE, true))
 
-		cfAccount, err = getAccount(ctx)
-		if err != nil {
-			failMessage("获取 Cloudflare 账号失败。")
-			log.Fatalln(err)
-		}
+	if createOpts.Type != "" {
+		deployType, _ := parseDeployType(createOpts.Type)
+		fmt.Printf("%s 部署方式: %s\n", info, fmtStr(deployType.String(), ORANGE, true))
+		return deployType
 	}
 
-	fmt.Printf("\n%s 获取设置...\n", title)
-	fmt.Printf("\n%s 你可以选择使用 %s 或 %s 进行部署。\n", info, fmtStr("Workers", ORANGE, true), fmtStr("Pages", ORANGE, true))
-	fmt.Printf("%s %s: 如果选择 %s，访问面板可能需要最多 5 分钟，请耐心等待！\n", info, warning, fmtStr("Pages", ORANGE, true))
-	var deployType DeployType
+	if assumeYes {
+		return DTWorker
+	}
 
 	for {
 		response := promptUser("请输入 1 选择 Workers 或 2 选择 Pages 部署: ")
 		switch response {
 		case "1":
-			deployType = DTWorker
+			return DTWorker
 		case "2":
-			deployType = DTPage
+			return DTPage
 		default:
 			failMessage("选择错误，请只输入 1 或 2！")
-			continue
 		}
-
-		break
 	}
+}
 
-	var projectName string
+// getProjectName asks for the panel name. isNew is false when the user agreed
+// to overwrite an existing Worker or Pages project of that name.
+func getProjectName(ctx context.Context, deployType DeployType) (name string, isNew bool) {
 	for {
-		projectName = generateRandomSubDomain(32)
-		fmt.Printf("\n%s 随机生成的名称（%s）为: %s\n", info, fmtStr("子域名", GREEN, true), fmtStr(projectName, ORANGE, true))
-		if response := promptUser("请输入自定义名称或直接回车使用生成的名称: "); response != "" {
-			if err := isValidSubDomain(response); err != nil {
-				failMessage(err.Error())
-				continue
-			}
+		projectName := createOpts.Name
+		if projectName == "" {
+			projectName = generateRandomSubDomain(credentialPolicy.ProjectName)
+			fmt.Printf("\n%s 随机生成的名称（%s）为: %s %s\n", info, fmtStr("子域名", GREEN, true), fmtStr(projectName, ORANGE, true), formatEntropy(credentialPolicy.ProjectName.entropy()))
+			if !assumeYes {
+				if response := promptUser("请输入自定义名称或直接回车使用生成的名称: "); response != "" {
+					if err := isValidSubDomain(response); err != nil {
+						failMessage(err.Error())
+						continue
+					}
 
-			projectName = response
+					projectName = response
+				}
+			}
+		} else {
+			fmt.Printf("\n%s 名称（%s）为: %s\n", info, fmtStr("子域名", GREEN, true), fmtStr(projectName, ORANGE, true))
 		}
 
 		var isAvailable bool
@@ -402,17 +533,30 @@ func createPanel() {
 
 		if !isAvailable {
 			prompt := fmt.Sprintf("该名称已存在！这将%s所有面板设置，是否覆盖？(y/n): ", fmtStr("重置", RED, true))
-			if response := promptUser(prompt); strings.ToLower(response) == "n" {
+			if !confirmStrict(prompt, true) {
+				createOpts.Name = ""
 				continue
 			}
 		}
 
 		successMessage("可用！")
-		break
+		return projectName, isAvailable
+	}
+}
+
+func getUUID() string {
+	if createOpts.UUID != "" {
+		fmt.Printf("\n%s %s 为: %s\n", info, fmtStr("UUID", GREEN, true), fmtStr(createOpts.UUID, ORANGE, true))
+		return createOpts.UUID
 	}
 
 	uid := uuid.NewString()
-	fmt.Printf("\n%s 随机生成的 %s 为: %s\n", info, fmtStr("UUID", GREEN, true), fmtStr(uid, ORANGE, true))
+	// A random (version 4) UUID carries 122 random bits.
+	fmt.Printf("\n%s 随机生成的 %s 为: %s %s\n", info, fmtStr("UUID", GREEN, true), fmtStr(uid, ORANGE, true), formatEntropy(122))
+	if assumeYes {
+		return uid
+	}
+
 	for {
 		if response := promptUser("请输入自定义 uid 或直接回车使用生成的 uid: "); response != "" {
 			if _, err := uuid.Parse(response); err != nil {
@@ -423,11 +567,22 @@ func createPanel() {
 			uid = response
 		}
 
-		break
+		return uid
+	}
+}
+
+func getTrPassword() string {
+	if createOpts.TrojanPass != "" {
+		fmt.Printf("\n%s %s 为: %s\n", info, fmtStr("Trojan 密码", GREEN, true), fmtStr(createOpts.TrojanPass, ORANGE, true))
+		return createOpts.TrojanPass
+	}
+
+	trPass := generateTrPassword(credentialPolicy.TrojanPass)
+	fmt.Printf("\n%s 随机生成的 %s 为: %s %s\n", info, fmtStr("Trojan 密码", GREEN, true), fmtStr(trPass, ORANGE, true), formatEntropy(credentialPolicy.TrojanPass.entropy()))
+	if assumeYes {
+		return trPass
 	}
 
-	trPass := generateTrPassword(12)
-	fmt.Printf("\n%s 随机生成的 %s 为: %s\n", info, fmtStr("Trojan 密码", GREEN, true), fmtStr(trPass, ORANGE, true))
 	for {
 		if response := promptUser("请输入自定义 Trojan 密码或直接回车使用生成的密码: "); response != "" {
 			if !isValidTrPassword(response) {
@@ -438,42 +593,83 @@ func createPanel() {
 			trPass = response
 		}
 
-		break
+		return trPass
+	}
+}
+
+func getProxyIP() string {
+	if createOpts.ProxyIP != "" {
+		fmt.Printf("\n%s %s 为: %s\n", info, fmtStr("代理 IP", GREEN, true), fmtStr(createOpts.ProxyIP, ORANGE, true))
+		return createOpts.ProxyIP
 	}
 
 	proxyIP := "bpb.yousef.isegaro.com"
 	fmt.Printf("\n%s 默认 %s 为: %s\n", info, fmtStr("代理 IP", GREEN, true), fmtStr(proxyIP, ORANGE, true))
+	if assumeYes {
+		return proxyIP
+	}
+
 	for {
 		if response := promptUser("请输入自定义代理 IP/域名，或直接回车使用默认值: "); response != "" {
-			areValid := true
-			values := strings.SplitSeq(response, ",")
-			for v := range values {
-				trimmedValue := strings.TrimSpace(v)
-				if !isValidIpDomain(trimmedValue) && !isValidHost(trimmedValue) {
-					areValid = false
-					message := fmt.Sprintf("%s 不是有效的 IP 或域名，请重试。", trimmedValue)
-					failMessage(message)
-				}
-			}
-
-			if !areValid {
+			if err := validateProxyIPs(response); err != nil {
+				failMessage(err.Error())
 				continue
 			}
 
 			proxyIP = response
 		}
 
-		break
+		return proxyIP
+	}
+}
+
+func validateProxyIPs(value string) error {
+	var invalid []string
+	for v := range strings.SplitSeq(value, ",") {
+		trimmedValue := strings.TrimSpace(v)
+		if !isValidIpDomain(trimmedValue) && !isValidHost(trimmedValue) {
+			invalid = append(invalid, trimmedValue)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%s 不是有效的 IP 或域名，请重试。", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
+
+func getFallback() string {
+	if createOpts.Fallback != "" {
+		fmt.Printf("\n%s %s 为: %s\n", info, fmtStr("回落域名", GREEN, true), fmtStr(createOpts.Fallback, ORANGE, true))
+		return createOpts.Fallback
 	}
 
 	fallback := "speed.cloudflare.com"
 	fmt.Printf("\n%s 默认 %s 为: %s\n", info, fmtStr("回落域名", GREEN, true), fmtStr(fallback, ORANGE, true))
+	if assumeYes {
+		return fallback
+	}
+
 	if response := promptUser("请输入自定义回落域名或直接回车使用默认值: "); response != "" {
 		fallback = response
 	}
 
-	subPath := generateSubURIPath(16)
-	fmt.Printf("\n%s 随机生成的 %s 为: %s\n", info, fmtStr("订阅路径", GREEN, true), fmtStr(subPath, ORANGE, true))
+	return fallback
+}
+
+func getSubPath() string {
+	if createOpts.SubPath != "" {
+		fmt.Printf("\n%s %s 为: %s\n", info, fmtStr("订阅路径", GREEN, true), fmtStr(createOpts.SubPath, ORANGE, true))
+		return createOpts.SubPath
+	}
+
+	subPath := generateSubURIPath(credentialPolicy.SubPath)
+	fmt.Printf("\n%s 随机生成的 %s 为: %s %s\n", info, fmtStr("订阅路径", GREEN, true), fmtStr(subPath, ORANGE, true), formatEntropy(credentialPolicy.SubPath.entropy()))
+	if assumeYes {
+		return subPath
+	}
+
 	for {
 		if response := promptUser("请输入自定义订阅路径或直接回车使用生成的路径: "); response != "" {
 			if !isValidSubURIPath(response) {
@@ -484,118 +680,464 @@ func createPanel() {
 			subPath = response
 		}
 
-		break
+		return subPath
 	}
+}
 
-	var customDomain string
+func getCustomDomains() []string {
 	fmt.Printf("\n%s 仅当你在本 Cloudflare 账号下注册了域名时，才可设置 %s。\n", info, fmtStr("自定义域名", GREEN, true))
-	if response := promptUser("请输入自定义域名（如有）或直接回车跳过: "); response != "" {
-		customDomain = response
+	if len(createOpts.CustomDomains) > 0 {
+		fmt.Printf("%s %s 为: %s\n", info, fmtStr("自定义域名", GREEN, true), fmtStr(strings.Join(createOpts.CustomDomains, ", "), ORANGE, true))
+		return createOpts.CustomDomains
+	}
+
+	if assumeYes {
+		return nil
+	}
+
+	for {
+		response := promptUser("请输入自定义域名（如有，多个用逗号分隔）或直接回车跳过: ")
+		if response == "" {
+			return nil
+		}
+
+		customDomains := splitList(response)
+		if err := validateCustomDomains(customDomains); err != nil {
+			failMessage(err.Error())
+			continue
+		}
+
+		return customDomains
+	}
+}
+
+func validateCustomDomains(customDomains []string) error {
+	domainRegex := regexp.MustCompile(DomainRegex)
+	var invalid []string
+	for _, customDomain := range customDomains {
+		if !domainRegex.MatchString(customDomain) {
+			invalid = append(invalid, customDomain)
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("%s 不是有效的域名，请重试。", strings.Join(invalid, ", "))
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var values []string
+	for v := range strings.SplitSeq(value, ",") {
+		if trimmedValue := strings.TrimSpace(v); trimmedValue != "" {
+			values = append(values, trimmedValue)
+		}
+	}
+
+	return values
+}
+
+func createPanel() {
+	ctx := context.Background()
+	var err error
+	if credentialPolicy, err = loadCredentialPolicy(); err != nil {
+		failMessage("凭据生成策略无效，请检查 config.json。")
+		log.Println(err)
+		emitError(err)
+		return
+	}
+
+	if err = ensureLogin(ctx); err != nil {
+		log.Println(err)
+		return
 	}
 
+	fmt.Printf("\n%s 获取设置...\n", title)
+	deployType := getDeployType()
+	projectName, isNew := getProjectName(ctx, deployType)
+	uid := getUUID()
+	trPass := getTrPassword()
+	proxyIP := getProxyIP()
+	fallback := getFallback()
+	subPath := getSubPath()
+	customDomains := getCustomDomains()
+	channel := panelChannel(nil)
+	release, err := resolveRelease(ctx, channel)
+	if err != nil {
+		failMessage("获取 BPB 面板版本失败。")
+		log.Println(err)
+		emitError(err)
+		return
+	}
+
+	// worker.js is fetched and verified before anything is created on the
+	// account, so a bad download does not leave resources behind.
+	digest, err := prepareWorker(ctx, release)
+	if err != nil {
+		failMessage("准备 worker.js 失败，已取消部署。")
+		fatal(err)
+	}
+
+	// Everything created from here on is deleted again when the creation
+	// fails or is interrupted.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resources.reset()
+	stopInterrupt := resources.handleInterrupt(cancel)
+	defer stopInterrupt()
+
 	fmt.Printf("\n%s 创建 KV 命名空间...\n", title)
+	emitStep("kv", StatusStarted, nil)
 	var kvNamespace *kv.Namespace
 
 	for {
-		now := time.Now().Format("2006-01-02_15-04-05")
-		kvName := fmt.Sprintf("panel-kv-%s", now)
+		kvName := createOpts.KVName
+		if kvName == "" {
+			now := time.Now().Format("2006-01-02_15-04-05")
+			kvName = fmt.Sprintf("panel-kv-%s", now)
+		}
+
 		kvNamespace, err = createKVNamespace(ctx, kvName)
 		if err != nil {
 			failMessage("创建 KV 失败。")
 			log.Printf("%v\n\n", err)
-			if response := promptUser("是否重试？(y/n): "); strings.ToLower(response) == "n" {
-				return
+			emitStepError("kv", err)
+			if !confirm("是否重试？(y/n): ", false) {
+				fatal(err)
 			}
 			continue
 		}
 
+		namespaceID := kvNamespace.ID
+		resources.add("kv_namespace", "KV 命名空间", kvName, func(ctx context.Context) error {
+			return deleteKVNamespace(ctx, namespaceID)
+		})
 		successMessage("KV 创建成功！")
+		emitStep("kv", StatusSucceeded, map[string]any{
+			"name":         kvName,
+			"namespace_id": kvNamespace.ID,
+		})
 		break
 	}
 
 	var panel string
-	if err := downloadWorker(); err != nil {
-		failMessage("下载 worker.js 失败")
-		log.Fatalln(err)
-	}
-
 	switch deployType {
 	case DTWorker:
-		panel, err = deployWorker(ctx, projectName, uid, trPass, proxyIP, fallback, subPath, kvNamespace, customDomain)
+		panel, err = deployWorker(ctx, projectName, uid, trPass, proxyIP, fallback, subPath, kvNamespace, customDomains, isNew)
 	case DTPage:
-		panel, err = deployPagesProject(ctx, projectName, uid, trPass, proxyIP, fallback, subPath, kvNamespace, customDomain)
+		panel, err = deployPagesProject(ctx, projectName, uid, trPass, proxyIP, fallback, subPath, kvNamespace, customDomains, isNew)
 	}
 
 	if err != nil {
 		failMessage("获取面板 URL 失败。")
-		log.Fatalln(err)
+		resources.abort(err)
+	}
+
+	// The panel is deployed; a failing health check alone does not undo it.
+	resources.commit()
+	stopInterrupt()
+
+	createdPanel := Panel{Name: projectName, Type: "workers"}
+	if deployType == DTPage {
+		createdPanel.Type = "pages"
+	}
+	rememberPanelChannel(createdPanel)
+
+	// The summary is printed and the result emitted whatever the checks
+	// below find, so the credentials of a deployed panel are never lost.
+	fmt.Printf("\n%s 部署摘要:\n", title)
+	fmt.Printf(" %s 面板地址: %s\n", info, fmtStr(panel, ORANGE, true))
+	fmt.Printf(" %s UUID: %s\n", info, fmtStr(uid, ORANGE, true))
+	fmt.Printf(" %s Trojan 密码: %s\n", info, fmtStr(trPass, ORANGE, true))
+	fmt.Printf(" %s 订阅路径: %s\n", info, fmtStr(subPath, ORANGE, true))
+	fmt.Printf(" %s 面板版本: %s（%s渠道）\n", info, fmtStr(release.TagName, GREEN, true), channelName(channel))
+	fmt.Printf(" %s worker.js SHA-256: %s（%s）\n", info, fmtStr(digest.SHA256, GREEN, false), digest.status())
+	fmt.Printf(" %s worker.js 来源: %s\n", info, release.source)
+
+	result := map[string]any{
+		"panel_url":       panel,
+		"type":            deployType.String(),
+		"name":            projectName,
+		"kv_namespace_id": kvNamespace.ID,
+		"uuid":            uid,
+		"trojan_pass":     trPass,
+		"proxy_ip":        proxyIP,
+		"fallback":        fallback,
+		"sub_path":        subPath,
+		"custom_domains":  customDomains,
+		"worker_version":  release.TagName,
+		"worker_sha256":   digest.SHA256,
+		"worker_source":   release.source,
+		"worker_verified": digest.verified(),
+		"channel":         channel,
 	}
 
-	if err := checkBPBPanel(panel); err != nil {
+	var warnings []string
+	if err := waitForCustomDomains(ctx, deployType, projectName, customDomains); err != nil {
+		failMessage("自定义域名未能生效，已跳过面板检测。")
+		log.Println(err)
+		warnings = append(warnings, err.Error())
+	} else if err := checkBPBPanel(panel); err != nil {
 		failMessage("检测 BPB 面板失败。")
-		log.Fatalln(err)
+		log.Println(err)
+		emitStepError("health_check", err)
+		warnings = append(warnings, err.Error())
+	}
+
+	result["panel_healthy"] = len(warnings) == 0
+	if len(warnings) > 0 {
+		result["warnings"] = warnings
+	}
+
+	emitResult(result)
+	if len(warnings) > 0 {
+		exit(1)
 	}
 }
 
-func modifyPanel() {
-	ctx := context.Background()
-	var err error
-	if cfClient == nil || cfAccount == nil {
-		go login()
-		token := <-obtainedToken
-		cfClient = NewClient(token)
+func getPanels(ctx context.Context) []Panel {
+	var panels []Panel
 
-		cfAccount, err = getAccount(ctx)
-		if err != nil {
-			failMessage("获取 Cloudflare 账号失败。")
-			log.Fatalln(err)
+	fmt.Printf("\n%s 获取面板列表...\n", title)
+	workersList, err := listWorkers(ctx)
+	if err != nil {
+		failMessage("获取 workers 列表失败。")
+		log.Println(err)
+	} else {
+		for _, worker := range workersList {
+			panels = append(panels, Panel{
+				Name: worker,
+				Type: "workers",
+			})
 		}
 	}
 
-	for {
-		var panels []Panel
-		var message string
+	pagesList, err := listPages(ctx)
+	if err != nil {
+		failMessage("获取 pages 列表失败。")
+		log.Println(err)
+	} else {
+		for _, pages := range pagesList {
+			panels = append(panels, Panel{
+				Name: pages,
+				Type: "pages",
+			})
+		}
+	}
+
+	return panels
+}
+
+func findPanel(ctx context.Context, name string, panelType string) (Panel, error) {
+	var matches []Panel
+	for _, panel := range getPanels(ctx) {
+		if panel.Name == name && (panelType == "" || panel.Type == panelType) {
+			matches = append(matches, panel)
+		}
+	}
 
-		fmt.Printf("\n%s 获取面板列表...\n", title)
-		workersList, err := listWorkers(ctx)
+	switch len(matches) {
+	case 0:
+		return Panel{}, fmt.Errorf("panel %q not found", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return Panel{}, fmt.Errorf("both a worker and a pages project are named %q, please specify --type", name)
+	}
+}
+
+func printPanels(panels []Panel) {
+	message := fmt.Sprintf("共找到 %d 个 workers 和 pages 项目:\n", len(panels))
+	successMessage(message)
+	for i, panel := range panels {
+		fmt.Printf(" %s %s - %s\n", fmtStr(strconv.Itoa(i+1)+".", BLUE, true), panel.Name, fmtStr(panel.Type, ORANGE, true))
+	}
+}
+
+func updatePanel(ctx context.Context, panel Panel) {
+	channel := panelChannel(&panel)
+	fmt.Printf("%s 更新渠道: %s\n", info, fmtStr(channelName(channel), ORANGE, true))
+	release, err := resolveRelease(ctx, channel)
+	if err != nil {
+		failMessage("获取 BPB 面板版本失败。")
+		log.Println(err)
+		emitError(err)
+		return
+	}
+
+	fmt.Printf("%s 将把 %s 更新到 %s 版本。\n", info, fmtStr(panel.Name, GREEN, true), fmtStr(release.TagName, GREEN, true))
+	current, err := deployedVersion(ctx, panel)
+	if err != nil {
+		log.Printf("%v\n", err)
+	}
+
+	digest, err := prepareWorker(ctx, release)
+	if err != nil {
+		failMessage("准备 worker.js 失败，已取消更新。")
+		fatal(err)
+	}
+
+	if !confirmUpdate(ctx, panel, current, preparedVersion, channel) {
+		fmt.Printf("%s 已跳过 %s 的更新。\n", info, panel.Name)
+		emitStep("update", StatusSkipped, map[string]any{"name": panel.Name, "type": panel.Type, "version": current})
+		emitResult(map[string]any{"name": panel.Name, "type": panel.Type, "worker_version": current, "skipped": true})
+		return
+	}
+
+	emitStep("secrets", StatusStarted, nil)
+	migrated, err := migrateSecrets(ctx, panel)
+	if err != nil {
+		failMessage("将面板变量迁移为加密变量失败，变量仍以明文保存。")
+		log.Println(err)
+		emitStepError("secrets", err)
+	} else if len(migrated) > 0 {
+		successMessage(fmt.Sprintf("已将 %s 改为加密变量。", strings.Join(migrated, ", ")))
+		emitStep("secrets", StatusSucceeded, map[string]any{"migrated": migrated})
+	} else {
+		emitStep("secrets", StatusSkipped, nil)
+	}
+
+	emitStep("update", StatusStarted, map[string]any{"name": panel.Name, "type": panel.Type, "version": release.TagName, "channel": channel})
+	if panel.Type == "workers" {
+		err = updateWorker(ctx, panel.Name)
+	} else {
+		err = updatePagesProject(ctx, panel.Name)
+	}
+
+	if err != nil {
+		failMessage("更新面板失败。")
+		emitStepError("update", err)
+		fatal(err)
+	}
+
+	rememberPanelChannel(panel)
+	successMessage("面板更新成功！\n")
+	emitStep("update", StatusSucceeded, nil)
+	fmt.Printf("%s 版本: %s，worker.js SHA-256: %s\n", info, fmtStr(release.TagName, GREEN, true), fmtStr(digest.SHA256, GREEN, false))
+	emitResult(map[string]any{"name": panel.Name, "type": panel.Type, "worker_version": release.TagName, "worker_sha256": digest.SHA256, "worker_source": release.source, "worker_verified": digest.verified(), "channel": channel})
+}
+
+func deletePanel(ctx context.Context, panel Panel) {
+	emitStep("delete", StatusStarted, map[string]any{"name": panel.Name, "type": panel.Type})
+	var err error
+	if panel.Type == "workers" {
+		err = deleteWorker(ctx, panel.Name)
+	} else {
+		err = deletePagesProject(ctx, panel.Name)
+	}
+
+	if err != nil {
+		failMessage("删除面板失败。")
+		emitStepError("delete", err)
+		fatal(err)
+	}
+
+	forgetPanel(panel)
+	successMessage("面板删除成功！\n")
+	emitStep("delete", StatusSucceeded, nil)
+	emitResult(map[string]any{"name": panel.Name, "type": panel.Type})
+}
+
+func showPanel(ctx context.Context, panel Panel) {
+	var panelURLs []string
+	vars := make(map[string]string)
+
+	if panel.Type == "workers" {
+		url, err := getWorkerPanelURL(ctx, panel.Name)
 		if err != nil {
-			failMessage("获取 workers 列表失败。")
-			log.Println(err)
-		} else {
-			for _, worker := range workersList {
-				panels = append(panels, Panel{
-					Name: worker,
-					Type: "workers",
-				})
-			}
+			failMessage("获取面板 URL 失败。")
+			fatal(err)
 		}
+		panelURLs = append(panelURLs, url)
 
-		pagesList, err := listPages(ctx)
+		domains, err := listWorkerCustomDomains(ctx, panel.Name)
 		if err != nil {
-			failMessage("获取 pages 列表失败。")
+			failMessage("获取自定义域名失败。")
 			log.Println(err)
-		} else {
-			for _, pages := range pagesList {
-				panels = append(panels, Panel{
-					Name: pages,
-					Type: "pages",
-				})
+		}
+		for _, domain := range domains {
+			panelURLs = append(panelURLs, "https://"+domain+"/panel")
+		}
+
+		bindings, err := getWorkerBindings(ctx, panel.Name)
+		if err != nil {
+			failMessage("获取面板设置失败。")
+			fatal(err)
+		}
+		for _, binding := range bindings {
+			switch binding.Type {
+			case "kv_namespace":
+				vars[binding.Name] = binding.NamespaceID
+			case "plain_text":
+				vars[binding.Name] = binding.Text
+			case "secret_text":
+				vars[binding.Name] = "(secret)"
 			}
 		}
+	} else {
+		project, err := getPagesProject(ctx, panel.Name)
+		if err != nil {
+			failMessage("获取面板设置失败。")
+			fatal(err)
+		}
 
+		panelURLs = append(panelURLs, "https://"+project.Subdomain+"/panel")
+		for _, domain := range project.Domains {
+			panelURLs = append(panelURLs, "https://"+domain+"/panel")
+		}
+
+		production := project.DeploymentConfigs.Production
+		for name, kvNamespace := range production.KVNamespaces {
+			vars[name] = kvNamespace.NamespaceID
+		}
+		for name, envVar := range production.EnvVars {
+			if envVar.Type == "secret_text" {
+				vars[name] = "(secret)"
+				continue
+			}
+			vars[name] = envVar.Value
+		}
+	}
+
+	fmt.Printf("\n%s %s - %s\n", title, fmtStr(panel.Name, GREEN, true), fmtStr(panel.Type, ORANGE, true))
+	for _, url := range panelURLs {
+		fmt.Printf("%s 面板地址: %s\n", info, fmtStr(url, BLUE, true))
+	}
+
+	for _, name := range []string{"kv", "UUID", "TR_PASS", "PROXY_IP", "FALLBACK", "SUB_PATH"} {
+		if value, ok := vars[name]; ok {
+			fmt.Printf("%s %s: %s\n", info, fmtStr(name, GREEN, true), value)
+		}
+	}
+
+	emitResult(map[string]any{
+		"name":       panel.Name,
+		"type":       panel.Type,
+		"panel_urls": panelURLs,
+		"vars":       vars,
+	})
+}
+
+func modifyPanel() {
+	ctx := context.Background()
+	if err := ensureLogin(ctx); err != nil {
+		log.Println(err)
+		return
+	}
+
+	for {
+		panels := getPanels(ctx)
 		if len(panels) == 0 {
 			failMessage("未找到 Workers 或 Pages，正在退出...")
 			return
 		}
 
-		message = fmt.Sprintf("共找到 %d 个 workers 和 pages 项目:\n", len(panels))
-		successMessage(message)
-		for i, panel := range panels {
-			fmt.Printf(" %s %s - %s\n", fmtStr(strconv.Itoa(i+1)+".", BLUE, true), panel.Name, fmtStr(panel.Type, ORANGE, true))
-		}
+		printPanels(panels)
 
 		var index int
 		for {
+			var err error
 			fmt.Println("")
 			response := promptUser("请选择你要修改的编号: ")
 			index, err = strconv.Atoi(response)
@@ -607,56 +1149,16 @@ func modifyPanel() {
 			break
 		}
 
-		panelName := panels[index-1].Name
-		panelType := panels[index-1].Type
+		panel := panels[index-1]
 
-		message = fmt.Sprintf("请输入 1 以%s面板，或 2 以%s面板: ", fmtStr("更新", GREEN, true), fmtStr("删除", RED, true))
-		response := promptUser(message)
 		for {
+			message := fmt.Sprintf("请输入 1 以%s面板，或 2 以%s面板: ", fmtStr("更新", GREEN, true), fmtStr("删除", RED, true))
+			response := promptUser(message)
 			switch response {
 			case "1":
-
-				if err := downloadWorker(); err != nil {
-					failMessage("下载 worker.js 失败")
-					log.Fatalln(err)
-				}
-
-				if panelType == "workers" {
-					if err := updateWorker(ctx, panelName); err != nil {
-						failMessage("更新面板失败。")
-						log.Fatalln(err)
-					}
-
-					successMessage("面板更新成功！\n")
-					break
-				}
-
-				if err := updatePagesProject(ctx, panelName); err != nil {
-					failMessage("更新面板失败。")
-					log.Fatalln(err)
-				}
-
-				successMessage("面板更新成功！\n")
-
+				updatePanel(ctx, panel)
 			case "2":
-
-				if panelType == "workers" {
-					if err := deleteWorker(ctx, panelName); err != nil {
-						failMessage("删除面板失败。")
-						log.Fatalln(err)
-					}
-
-					successMessage("面板删除成功！\n")
-					break
-				}
-
-				if err := deletePagesProject(ctx, panelName); err != nil {
-					failMessage("删除面板失败。")
-					log.Fatalln(err)
-				}
-
-				successMessage("面板删除成功！\n")
-
+				deletePanel(ctx, panel)
 			default:
 				failMessage("选择错误，请只输入 1 或 2！")
 				continue
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"mime/multipart"
 	"net/textproto"
 	"os"
@@ -17,8 +18,6 @@ import (
 	"github.com/cloudflare/cloudflare-go/v4/kv"
 	"github.com/cloudflare/cloudflare-go/v4/option"
 	"github.com/cloudflare/cloudflare-go/v4/workers"
-	"github.com/cloudflare/cloudflare-go/v4/zones"
-	"github.com/joeguo/tldextract"
 )
 
 type ScriptUpdateParams struct {
@@ -143,31 +142,11 @@ func createWorker(ctx context.Context, name string, uid string, pass string, pro
 					"namespace_id": kv.ID,
 					"type":         "kv_namespace",
 				},
-				{
-					"name": "UUID",
-					"text": uid,
-					"type": "plain_text",
-				},
-				{
-					"name": "TR_PASS",
-					"text": pass,
-					"type": "plain_text",
-				},
-				{
-					"name": "PROXY_IP",
-					"text": proxy,
-					"type": "plain_text",
-				},
-				{
-					"name": "FALLBACK",
-					"text": fallback,
-					"type": "plain_text",
-				},
-				{
-					"name": "SUB_PATH",
-					"text": sub,
-					"type": "plain_text",
-				},
+				workerBinding("UUID", uid),
+				workerBinding("TR_PASS", pass),
+				workerBinding("PROXY_IP", proxy),
+				workerBinding("FALLBACK", fallback),
+				workerBinding("SUB_PATH", sub),
 			},
 			MainModule:        "worker.js",
 			jsPath:            workerPath,
@@ -213,6 +192,15 @@ func createKVNamespace(ctx context.Context, ns string) (*kv.Namespace, error) {
 	return res, nil
 }
 
+func deleteKVNamespace(ctx context.Context, id string) error {
+	_, err := cfClient.KV.Namespaces.Delete(ctx, id, kv.NamespaceDeleteParams{AccountID: cf.F(cfAccount.ID)})
+	if err != nil {
+		return fmt.Errorf("error deleting KV namespace: %w", err)
+	}
+
+	return nil
+}
+
 func enableWorkerSubdomain(ctx context.Context, name string) (*workers.ScriptSubdomainNewResponse, error) {
 	return cfClient.Workers.Scripts.Subdomain.New(
 		ctx,
@@ -225,27 +213,11 @@ func enableWorkerSubdomain(ctx context.Context, name string) (*workers.ScriptSub
 }
 
 func addWorkerCustomDomain(ctx context.Context, script string, customDomain string) (string, error) {
-	extractor, err := tldextract.New(cachePath, false)
-	if err != nil {
-		return "", fmt.Errorf("error extracting TLD: %w", err)
-	}
-
-	result := extractor.Extract(customDomain)
-	domain := fmt.Sprintf("%s.%s", result.Root, result.Tld)
-
-	zones, err := cfClient.Zones.List(ctx, zones.ZoneListParams{
-		Account: cf.F(zones.ZoneListParamsAccount{
-			ID: cf.F(cfAccount.ID),
-		}),
-		Match: cf.F(zones.ZoneListParamsMatch("contains")),
-		Name:  cf.F(domain),
-	})
-
+	zone, err := findZone(ctx, customDomain)
 	if err != nil {
-		return "", fmt.Errorf("error listing zones: %w", err)
+		return "", err
 	}
 
-	zone := zones.Result[0]
 	res, err := cfClient.Workers.Domains.Update(ctx, workers.DomainUpdateParams{
 		AccountID:   cf.F(cfAccount.ID),
 		Environment: cf.F("production"),
@@ -261,6 +233,25 @@ func addWorkerCustomDomain(ctx context.Context, script string, customDomain stri
 	return res.Hostname, nil
 }
 
+func deleteWorkerCustomDomain(ctx context.Context, script string, hostname string) error {
+	res, err := cfClient.Workers.Domains.List(ctx, workers.DomainListParams{
+		AccountID: cf.F(cfAccount.ID),
+		Service:   cf.F(script),
+		Hostname:  cf.F(hostname),
+	})
+	if err != nil {
+		return fmt.Errorf("error listing worker domains: %w", err)
+	}
+
+	for _, domain := range res.Result {
+		if err := cfClient.Workers.Domains.Delete(ctx, domain.ID, workers.DomainDeleteParams{AccountID: cf.F(cfAccount.ID)}); err != nil {
+			return fmt.Errorf("error deleting worker domain: %w", err)
+		}
+	}
+
+	return nil
+}
+
 func isWorkerAvailable(ctx context.Context, name string) bool {
 	_, err := cfClient.Workers.Scripts.Get(ctx, name, workers.ScriptGetParams{AccountID: cf.F(cfAccount.ID)})
 	return err != nil
@@ -340,60 +331,96 @@ func deployWorker(
 	fallback string,
 	sub string,
 	kvNamespace *kv.Namespace,
-	customDomain string,
+	customDomains []string,
+	isNew bool,
 ) (
 	panelURL string,
 	err error,
 ) {
 	for {
 		fmt.Printf("\n%s Creating Worker...\n", title)
+		emitStep("worker_upload", StatusStarted, nil)
 
 		_, err := createWorker(ctx, name, uid, pass, proxy, fallback, sub, kvNamespace)
 		if err != nil {
 			failMessage("Failed to deploy worker.")
 			log.Printf("%v\n\n", err)
-			if response := promptUser("Would you like to try again? (y/n): "); strings.ToLower(response) == "n" {
-				return "", nil
+			emitStepError("worker_upload", err)
+			if !confirm("Would you like to try again? (y/n): ", false) {
+				return "", err
 			}
 			continue
 		}
 
+		// An overwritten panel and its domains were there before, so they are
+		// not rolled back.
+		if isNew {
+			resources.add("worker", "Worker", name, func(ctx context.Context) error {
+				return deleteWorker(ctx, name)
+			})
+		} else {
+			// The overwritten panel is bound to the new KV namespace now.
+			resources.keep("kv_namespace")
+		}
 		successMessage("Worker created successfully!")
+		emitStep("worker_upload", StatusSucceeded, nil)
 		break
 	}
 
+	emitStep("subdomain", StatusStarted, nil)
 	for {
 		_, err := enableWorkerSubdomain(ctx, name)
 		if err != nil {
 			failMessage("Failed to enable worker subdomain.")
 			log.Printf("%v\n\n", err)
-			if response := promptUser("Would you like to try again? (y/n): "); strings.ToLower(response) == "n" {
-				return "", nil
+			emitStepError("subdomain", err)
+			if !confirm("Would you like to try again? (y/n): ", false) {
+				return "", err
 			}
 			continue
 		}
 
 		successMessage("Worker subdomain enabled successfully!")
+		emitStep("subdomain", StatusSucceeded, nil)
 		break
 	}
 
-	if customDomain != "" {
+	for _, customDomain := range customDomains {
+		emitStep("custom_domain", StatusStarted, map[string]any{"domain": customDomain})
 		for {
 			_, err := addWorkerCustomDomain(ctx, name, customDomain)
 			if err != nil {
 				failMessage("Failed to add custom domain.")
 				log.Printf("%v\n\n", err)
-				if response := promptUser("Would you like to try again? (y/n): "); strings.ToLower(response) == "n" {
-					return "", nil
+				emitStepError("custom_domain", err)
+				if !confirm("Would you like to try again? (y/n): ", false) {
+					return "", err
 				}
 				continue
 			}
 
+			if isNew {
+				resources.add("worker_domain", "自定义域名", customDomain, func(ctx context.Context) error {
+					return deleteWorkerCustomDomain(ctx, name, customDomain)
+				})
+			}
 			successMessage("Custom domain added to worker successfully!")
-			return "https://" + customDomain + "/panel", nil
+			emitStep("custom_domain", StatusSucceeded, map[string]any{"domain": customDomain})
+			if panelURL == "" {
+				panelURL = "https://" + customDomain + "/panel"
+			}
+			break
 		}
 	}
 
+	if panelURL != "" {
+		return panelURL, nil
+	}
+
+	return getWorkerPanelURL(ctx, name)
+}
+
+func getWorkerPanelURL(ctx context.Context, name string) (string, error) {
 	resp, err := cfClient.Workers.Subdomains.Get(ctx, workers.SubdomainGetParams{AccountID: cf.F(cfAccount.ID)})
 	if err != nil {
 		return "", fmt.Errorf("error getting worker subdomain - %w", err)
@@ -401,3 +428,62 @@ func deployWorker(
 
 	return "https://" + name + "." + resp.Subdomain + ".workers.dev/panel", nil
 }
+
+func getWorkerBindings(ctx context.Context, name string) ([]workers.ScriptScriptAndVersionSettingGetResponseBinding, error) {
+	settings, err := cfClient.Workers.Scripts.ScriptAndVersionSettings.Get(ctx, name, workers.ScriptScriptAndVersionSettingGetParams{
+		AccountID: cf.F(cfAccount.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting worker settings: %w", err)
+	}
+
+	return settings.Bindings, nil
+}
+
+func listWorkerCustomDomains(ctx context.Context, name string) ([]string, error) {
+	res, err := cfClient.Workers.Domains.List(ctx, workers.DomainListParams{
+		AccountID: cf.F(cfAccount.ID),
+		Service:   cf.F(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing worker domains: %w", err)
+	}
+
+	var hostnames []string
+	for _, domain := range res.Result {
+		hostnames = append(hostnames, domain.Hostname)
+	}
+
+	return hostnames, nil
+}
+
+// getWorkerScript downloads the main module of a deployed worker.
+func getWorkerScript(ctx context.Context, name string) ([]byte, error) {
+	resp, err := cfClient.Workers.Scripts.Content.Get(ctx, name, workers.ScriptContentGetParams{
+		AccountID: cf.F(cfAccount.ID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting worker script: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Module workers may come back as a multipart upload, the main module
+	// being the first part.
+	body := io.Reader(resp.Body)
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		part, err := multipart.NewReader(resp.Body, params["boundary"]).NextPart()
+		if err != nil {
+			return nil, fmt.Errorf("error reading worker script: %w", err)
+		}
+
+		body = part
+	}
+
+	script, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading worker script: %w", err)
+	}
+
+	return script, nil
+}